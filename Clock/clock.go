@@ -0,0 +1,76 @@
+package Clock
+
+import (
+	"errors"
+	"time"
+)
+
+// TimeControl describes the time limits of a game. Either Initial, with an
+// optional Increment added after every move, or a fixed PerMove budget is set.
+type TimeControl struct {
+	Initial   time.Duration `json:"initial"`
+	Increment time.Duration `json:"increment"`
+	PerMove   time.Duration `json:"perMove"`
+}
+
+// Clock keeps the remaining time of both players
+type Clock struct {
+	Control   TimeControl      `json:"control"`
+	Remaining [2]time.Duration `json:"remaining"`
+	TurnStart time.Time        `json:"turnStart"`
+}
+
+// Validate checks that the time control is usable
+func (tc TimeControl) Validate() error {
+	if tc.Initial < 0 || tc.Increment < 0 || tc.PerMove < 0 {
+		return errors.New("time control values must not be negative")
+	}
+	if tc.PerMove > 0 && (tc.Initial > 0 || tc.Increment > 0) {
+		return errors.New("per-move time cannot be combined with initial time and increment")
+	}
+	if tc.PerMove == 0 && tc.Initial == 0 {
+		return errors.New("time control needs initial time or per-move time")
+	}
+	return nil
+}
+
+// NewClock starts a clock for the first player at now
+func NewClock(tc TimeControl, now time.Time) *Clock {
+	start := tc.Initial
+	if tc.PerMove > 0 {
+		start = tc.PerMove
+	}
+	return &Clock{
+		Control:   tc,
+		Remaining: [2]time.Duration{start, start},
+		TurnStart: now,
+	}
+}
+
+// Left returns the time player has left at now, counting the running turn
+func (c *Clock) Left(player int, toMove int, now time.Time) time.Duration {
+	left := c.Remaining[player]
+	if player == toMove {
+		left -= now.Sub(c.TurnStart)
+	}
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// Flagged reports whether the player to move has run out of time
+func (c *Clock) Flagged(toMove int, now time.Time) bool {
+	return c.Left(toMove, toMove, now) == 0
+}
+
+// Switch stops the mover's clock at now and starts the opponent's
+func (c *Clock) Switch(mover int, now time.Time) {
+	if c.Control.PerMove > 0 {
+		c.Remaining[mover] = c.Control.PerMove
+	} else {
+		c.Remaining[mover] -= now.Sub(c.TurnStart)
+		c.Remaining[mover] += c.Control.Increment
+	}
+	c.TurnStart = now
+}
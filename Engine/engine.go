@@ -0,0 +1,78 @@
+package Engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"connect4/Position"
+)
+
+// Move is the column an engine plays, -1 when it has none
+type Move int
+
+// Limits bound a search. Zero fields leave the choice to the engine.
+type Limits struct {
+	Depth      int           // plies, for engines that search by depth
+	MoveTime   time.Duration // time to think
+	Iterations int           // playouts, for engines that sample
+	Seed       int64         // seeds the engine's random choices so they repeat, 0 for choices that vary
+}
+
+// Info describes the search behind a move
+type Info struct {
+	Score    int    `json:"score"`           // from the point of view of the player to move, 0 when unknown
+	Depth    int    `json:"depth,omitempty"` // deepest finished search, 0 for engines that do not search by depth
+	Nodes    uint64 `json:"nodes"`           // positions or playouts searched
+	TTHits   uint64 `json:"-"`
+	TTMisses uint64 `json:"-"`
+}
+
+// Engine picks moves for the bot. BestMove must not change position and
+// returns -1 when ctx ends before it has a move.
+type Engine interface {
+	Name() string
+	BestMove(ctx context.Context, position *Position.Position, limits Limits) (Move, Info)
+}
+
+var (
+	engines      = make(map[string]Engine)
+	enginesMutex sync.RWMutex
+)
+
+// Default is the name of the engine games use unless they pick another
+const Default = "default"
+
+// Register makes engine available by its name. It panics if the name is taken.
+func Register(engine Engine) {
+	enginesMutex.Lock()
+	defer enginesMutex.Unlock()
+
+	if _, ok := engines[engine.Name()]; ok {
+		panic(fmt.Sprintf("engine %q registered twice", engine.Name()))
+	}
+	engines[engine.Name()] = engine
+}
+
+// Get returns the engine registered as name
+func Get(name string) (Engine, bool) {
+	enginesMutex.RLock()
+	defer enginesMutex.RUnlock()
+	engine, ok := engines[name]
+	return engine, ok
+}
+
+// Names returns the names of every registered engine, sorted
+func Names() []string {
+	enginesMutex.RLock()
+	defer enginesMutex.RUnlock()
+
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,174 @@
+package Engine
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"connect4/MCTS"
+	"connect4/Position"
+	"connect4/Solver"
+	"connect4/Transposition"
+)
+
+func init() {
+	Register(NewSolver(Default, 10, 0, 0))
+	Register(NewSolver("exact", 0, 10*time.Second, 0))
+	Register(NewSolver("easy", 4, 0, 0.3))
+	Register(NewSolver("medium", 6, 0, 0.1))
+	Register(Random{})
+	for _, personality := range MCTS.Personalities {
+		Register(NewMCTS("mcts-"+personality.Name, personality))
+	}
+}
+
+// SeededTables is how many seeded searches can run at once. Entries left in
+// the shared table by other searches would change the scores ties are broken
+// on, so a seed only repeats its moves from an empty table of its own; further
+// seeded searches wait for one to be free.
+const SeededTables = 2
+
+var (
+	seededTableBytes = Solver.DefaultTableBytes / 16
+	seededTables     = make(chan *Transposition.Table, SeededTables)
+	seededTablesOnce sync.Once
+)
+
+// SetSeededTableSize sets the memory used by each seeded search's table. It
+// must be called before the first seeded search.
+func SetSeededTableSize(bytes int) {
+	seededTableBytes = bytes
+}
+
+// seededTable waits for a free seeded table and returns it empty, or nil once
+// ctx is done. The caller hands it back with releaseTable.
+func seededTable(ctx context.Context) *Transposition.Table {
+	seededTablesOnce.Do(func() {
+		for i := 0; i < SeededTables; i++ {
+			seededTables <- Transposition.NewTable(seededTableBytes)
+		}
+	})
+	select {
+	case table := <-seededTables:
+		table.Clear()
+		return table
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// releaseTable makes a table from seededTable free again
+func releaseTable(table *Transposition.Table) {
+	seededTables <- table
+}
+
+// newRand returns a generator seeded with seed, or randomly when seed is 0
+func newRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// solverEngine plays the Solver's best move, deepening iteratively so a time
+// limit still leaves the move of the deepest finished depth
+type solverEngine struct {
+	name        string
+	depth       int
+	moveTime    time.Duration
+	temperature float64
+}
+
+// NewSolver makes an engine that searches depth plies, or to the end of the
+// game when depth is 0, for at most moveTime unless the limits say otherwise.
+// A moveTime of 0 does not limit the search. Equally good moves are picked at
+// random, and temperature is the chance of playing one of the second best.
+func NewSolver(name string, depth int, moveTime time.Duration, temperature float64) Engine {
+	return solverEngine{name: name, depth: depth, moveTime: moveTime, temperature: temperature}
+}
+
+func (e solverEngine) Name() string { return e.name }
+
+func (e solverEngine) BestMove(ctx context.Context, position *Position.Position, limits Limits) (Move, Info) {
+	depth := e.depth
+	if limits.Depth > 0 {
+		depth = limits.Depth
+	}
+	if depth == 0 {
+		depth = position.BoardWidth*position.BoardHeight - position.NumMoves
+	}
+	moveTime := e.moveTime
+	if limits.MoveTime > 0 {
+		moveTime = limits.MoveTime
+	}
+	if moveTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, moveTime)
+		defer cancel()
+	}
+
+	opts := Solver.Options{
+		Depth:       depth,
+		Iterative:   true,
+		Rand:        newRand(limits.Seed),
+		Temperature: e.temperature,
+	}
+	if limits.Seed != 0 {
+		table := seededTable(ctx)
+		if table == nil {
+			return -1, Info{}
+		}
+		defer releaseTable(table)
+		opts.Table = table
+	}
+	score, col, stats, err := Solver.Search(ctx, position, opts)
+	info := Info{Score: score, Depth: stats.Depth, Nodes: stats.Nodes, TTHits: stats.TTHits, TTMisses: stats.TTMisses}
+	if err != nil {
+		return -1, info
+	}
+	return Move(col), info
+}
+
+// mctsEngine plays the move Monte Carlo tree search visits most
+type mctsEngine struct {
+	name        string
+	personality MCTS.Personality
+}
+
+// NewMCTS makes a Monte Carlo tree search engine with the given personality.
+// Its limits are used when the caller gives neither iterations nor a move time.
+func NewMCTS(name string, personality MCTS.Personality) Engine {
+	return mctsEngine{name: name, personality: personality}
+}
+
+func (e mctsEngine) Name() string { return e.name }
+
+func (e mctsEngine) BestMove(ctx context.Context, position *Position.Position, limits Limits) (Move, Info) {
+	searchLimits := MCTS.Limits{Iterations: limits.Iterations, MoveTime: limits.MoveTime}
+	if limits.Iterations == 0 {
+		searchLimits.Iterations = e.personality.Limits.Iterations
+	}
+	rng := newRand(limits.Seed)
+	result := MCTS.Search(ctx, position, searchLimits, e.personality, rng)
+	return Move(result.Col), Info{Nodes: uint64(result.Iterations)}
+}
+
+// Random plays a random legal move
+type Random struct{}
+
+func (Random) Name() string { return "random" }
+
+func (Random) BestMove(ctx context.Context, position *Position.Position, limits Limits) (Move, Info) {
+	var cols []int
+	for col := 0; col < position.BoardWidth; col++ {
+		if position.CanPlay(col) {
+			cols = append(cols, col)
+		}
+	}
+	if len(cols) == 0 {
+		return -1, Info{}
+	}
+	rng := newRand(limits.Seed)
+	return Move(cols[rng.Intn(len(cols))]), Info{Nodes: 1}
+}
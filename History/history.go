@@ -0,0 +1,204 @@
+package History
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Move is one ply of a recorded game
+type Move struct {
+	Column int       `json:"column"`
+	Player int       `json:"player"`
+	Time   time.Time `json:"time"`
+}
+
+// Record is a finished game
+type Record struct {
+	ID        string    `json:"id"`
+	PlayerIDs [2]string `json:"playerIds"`
+	Winner    int       `json:"winner"` // 0 or 1 for the winning seat, 2 for a draw
+	EndReason string    `json:"endReason"`
+	Started   time.Time `json:"started"`
+	Ended     time.Time `json:"ended"`
+	Moves     []Move    `json:"moves,omitempty"`
+}
+
+// Filter narrows down List. Zero values match everything.
+type Filter struct {
+	PlayerID string
+	Result   string // "win", "loss" or "draw"; win and loss are from PlayerID's side
+	From     time.Time
+	To       time.Time
+}
+
+// Results accepted by Filter
+const (
+	ResultWin  = "win"
+	ResultLoss = "loss"
+	ResultDraw = "draw"
+)
+
+// ErrResultNeedsPlayer is returned when filtering wins or losses without a player
+var ErrResultNeedsPlayer = errors.New("win and loss filters need a player")
+
+// Archive keeps finished games in memory and, when path is set, appends them
+// to a JSON lines file
+type Archive struct {
+	path    string
+	records []Record // ordered by end time
+	byID    map[string]int
+	mutex   sync.Mutex
+}
+
+// NewArchive creates an Archive, loading games previously saved at path.
+// An empty path keeps games in memory only.
+func NewArchive(path string) (*Archive, error) {
+	a := &Archive{
+		path: path,
+		byID: make(map[string]int),
+	}
+	if path == "" {
+		return a, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, err
+		}
+		a.records = append(a.records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(a.records, func(i, j int) bool {
+		return a.records[i].Ended.Before(a.records[j].Ended)
+	})
+	for i, r := range a.records {
+		a.byID[r.ID] = i
+	}
+	return a, nil
+}
+
+// Add stores a finished game
+func (a *Archive) Add(r Record) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.byID[r.ID] = len(a.records)
+	a.records = append(a.records, r)
+
+	if a.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// Get returns the game with the given ID
+func (a *Archive) Get(id string) (Record, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	i, ok := a.byID[id]
+	if !ok {
+		return Record{}, false
+	}
+	return a.records[i], true
+}
+
+// List returns one page of games matching filter, newest first, without
+// their moves, together with the total number of matches
+func (a *Archive) List(filter Filter, page int, pageSize int) ([]Record, int, error) {
+	if (filter.Result == ResultWin || filter.Result == ResultLoss) && filter.PlayerID == "" {
+		return nil, 0, ErrResultNeedsPlayer
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var matches []Record
+	for i := len(a.records) - 1; i >= 0; i-- {
+		r := a.records[i]
+		if filter.matches(r) {
+			r.Moves = nil
+			matches = append(matches, r)
+		}
+	}
+
+	total := len(matches)
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []Record{}, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return matches[start:end], total, nil
+}
+
+func (f Filter) matches(r Record) bool {
+	seat := -1
+	if f.PlayerID != "" {
+		for i, id := range r.PlayerIDs {
+			if id == f.PlayerID {
+				seat = i
+			}
+		}
+		if seat == -1 {
+			return false
+		}
+	}
+
+	switch f.Result {
+	case ResultWin:
+		if r.Winner != seat {
+			return false
+		}
+	case ResultLoss:
+		if r.Winner != 1-seat {
+			return false
+		}
+	case ResultDraw:
+		if r.Winner != 2 {
+			return false
+		}
+	}
+
+	if !f.From.IsZero() && r.Ended.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.Ended.Before(f.To) {
+		return false
+	}
+	return true
+}
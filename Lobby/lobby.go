@@ -0,0 +1,186 @@
+package Lobby
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"connect4/Clock"
+
+	"github.com/google/uuid"
+)
+
+// Ticket is a player waiting in the queue
+type Ticket struct {
+	ID          string
+	PlayerID    string // empty for anonymous players
+	Rating      float64
+	TimeControl Clock.TimeControl // zero for untimed games
+	RatingBand  bool              // only pair with players in the same rating band
+	lastPoll    time.Time
+	match       chan Match
+}
+
+// Match tells a waiting player which game and seat they were paired into
+type Match struct {
+	GameID    string `json:"gameId"`
+	Seat      int    `json:"seat"`
+	SeatToken string `json:"seatToken"`
+}
+
+// Pairer creates the two-seat game for a pair of tickets and returns the
+// match for each ticket, in the same order
+type Pairer func(a, b Ticket) ([2]Match, error)
+
+// ErrUnknownTicket is returned for tickets that left, expired or never existed
+var ErrUnknownTicket = errors.New("unknown ticket")
+
+// Lobby pairs waiting players into new games
+type Lobby struct {
+	pair       Pairer
+	bandWidth  float64
+	staleAfter time.Duration
+	queue      []*Ticket          // waiting, oldest first
+	tickets    map[string]*Ticket // waiting or matched but not yet told
+	mutex      sync.Mutex
+}
+
+// New creates a Lobby. Ratings are grouped into bands bandWidth wide, and
+// tickets that are not polled for staleAfter are dropped.
+func New(pair Pairer, bandWidth float64, staleAfter time.Duration) *Lobby {
+	return &Lobby{
+		pair:       pair,
+		bandWidth:  bandWidth,
+		staleAfter: staleAfter,
+		tickets:    make(map[string]*Ticket),
+	}
+}
+
+// Join queues a new ticket, pairing it at once with the longest waiting
+// compatible player if there is one
+func (l *Lobby) Join(t Ticket) (string, error) {
+	now := time.Now()
+	t.ID = uuid.New().String()
+	t.lastPoll = now
+	t.match = make(chan Match, 1)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.prune(now)
+
+	for i, waiting := range l.queue {
+		if !l.compatible(waiting, &t) {
+			continue
+		}
+
+		matches, err := l.pair(*waiting, t)
+		if err != nil {
+			return "", err
+		}
+		l.queue = append(l.queue[:i], l.queue[i+1:]...)
+		waiting.match <- matches[0]
+		t.match <- matches[1]
+		l.tickets[t.ID] = &t
+		return t.ID, nil
+	}
+
+	l.queue = append(l.queue, &t)
+	l.tickets[t.ID] = &t
+	return t.ID, nil
+}
+
+// Wait blocks until the ticket is matched, timeout passes or ctx is done.
+// It reports false when no match arrived in time.
+func (l *Lobby) Wait(ctx context.Context, id string, timeout time.Duration) (Match, bool, error) {
+	l.mutex.Lock()
+	t, ok := l.tickets[id]
+	if ok {
+		t.lastPoll = time.Now()
+	}
+	l.mutex.Unlock()
+
+	if !ok {
+		return Match{}, false, ErrUnknownTicket
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case m := <-t.match:
+		l.mutex.Lock()
+		delete(l.tickets, id)
+		l.mutex.Unlock()
+		return m, true, nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	l.mutex.Lock()
+	t.lastPoll = time.Now()
+	l.mutex.Unlock()
+	return Match{}, false, nil
+}
+
+// Leave removes a waiting ticket. Tickets that were already matched stay so
+// the player can still collect the game.
+func (l *Lobby) Leave(id string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for i, t := range l.queue {
+		if t.ID == id {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			delete(l.tickets, id)
+			return true
+		}
+	}
+	return false
+}
+
+// Waiting returns the number of players in the queue
+func (l *Lobby) Waiting() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.queue)
+}
+
+// compatible reports whether two tickets may be paired
+func (l *Lobby) compatible(a, b *Ticket) bool {
+	if a.TimeControl != b.TimeControl {
+		return false
+	}
+	if a.PlayerID != "" && a.PlayerID == b.PlayerID {
+		return false
+	}
+	if a.RatingBand || b.RatingBand {
+		return l.band(a.Rating) == l.band(b.Rating)
+	}
+	return true
+}
+
+func (l *Lobby) band(rating float64) int {
+	return int(math.Floor(rating / l.bandWidth))
+}
+
+// prune drops tickets whose players stopped polling; callers must hold the mutex
+func (l *Lobby) prune(now time.Time) {
+	kept := l.queue[:0]
+	for _, t := range l.queue {
+		if now.Sub(t.lastPoll) > l.staleAfter {
+			delete(l.tickets, t.ID)
+			continue
+		}
+		kept = append(kept, t)
+	}
+	l.queue = kept
+
+	for id, t := range l.tickets {
+		if now.Sub(t.lastPoll) > l.staleAfter {
+			delete(l.tickets, id)
+		}
+	}
+}
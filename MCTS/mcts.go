@@ -0,0 +1,242 @@
+package MCTS
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"connect4/Position"
+)
+
+// Limits bound a search. Zero fields are unlimited, but at least one must be set.
+type Limits struct {
+	Iterations int
+	MoveTime   time.Duration
+}
+
+// Personality tunes how the engine plays
+type Personality struct {
+	Name string
+
+	// Exploration is the UCT constant. Higher values spread the playouts
+	// over more moves instead of deepening the most promising one.
+	Exploration float64
+
+	// Tactical is the chance that a playout move takes an immediate win or
+	// blocks one instead of being random. At 0 playouts are purely random.
+	Tactical float64
+
+	Limits Limits // budget used when the caller has none
+}
+
+// Personalities are the built-in personalities by name, weakest first
+var Personalities = map[string]Personality{
+	"casual":   {Name: "casual", Exploration: 1.4, Tactical: 0, Limits: Limits{Iterations: 1500}},
+	"balanced": {Name: "balanced", Exploration: 1.0, Tactical: 0.5, Limits: Limits{Iterations: 6000}},
+	"sharp":    {Name: "sharp", Exploration: 0.8, Tactical: 1, Limits: Limits{Iterations: 20000}},
+}
+
+// Result is the outcome of a search
+type Result struct {
+	Col        int     // most visited move, -1 if the game is over
+	Visits     int     // playouts through Col
+	Value      float64 // share of those playouts Col won, counting draws as half
+	Iterations int     // playouts in total
+}
+
+// node is a position in the search tree, reached by mover playing col
+type node struct {
+	col      int
+	mover    int
+	terminal bool
+	untried  uint8 // columns not expanded yet, one bit each
+	children [7]int32
+	n        int
+	visits   float64
+	wins     float64 // for mover, draws counting half
+}
+
+// searchTree holds the nodes of one search in a single slice
+type searchTree struct {
+	nodes       []node
+	personality Personality
+	rng         *rand.Rand
+}
+
+// checkInterval is how many iterations run between clock and context checks
+const checkInterval = 64
+
+// Search runs UCT with playouts from position until limits or ctx end it,
+// and returns the move it visited most. The position is not changed.
+func Search(ctx context.Context, position *Position.Position, limits Limits, personality Personality, rng *rand.Rand) Result {
+	if limits == (Limits{}) {
+		limits = personality.Limits
+	}
+	var deadline time.Time
+	if limits.MoveTime > 0 {
+		deadline = time.Now().Add(limits.MoveTime)
+	}
+
+	t := &searchTree{personality: personality, rng: rng}
+	root := t.newNode(position, -1, 1-position.GetCurrentPlayer())
+	t.nodes[root].terminal = finished(position)
+	if t.nodes[root].terminal || t.nodes[root].untried == 0 {
+		return Result{Col: -1}
+	}
+
+	path := make([]int32, 0, position.BoardWidth*position.BoardHeight+1)
+	iterations := 0
+	for limits.Iterations == 0 || iterations < limits.Iterations {
+		if iterations%checkInterval == 0 && iterations > 0 {
+			if ctx.Err() != nil || (!deadline.IsZero() && time.Now().After(deadline)) {
+				break
+			}
+		}
+		scratch := *position
+		path = t.iterate(&scratch, root, path[:0])
+		iterations++
+	}
+
+	result := Result{Col: -1, Iterations: iterations}
+	r := &t.nodes[root]
+	for _, i := range r.children[:r.n] {
+		child := &t.nodes[i]
+		if int(child.visits) > result.Visits {
+			result.Col = child.col
+			result.Visits = int(child.visits)
+			result.Value = child.wins / child.visits
+		}
+	}
+	return result
+}
+
+// newNode adds the node reached by mover playing col, now at position
+func (t *searchTree) newNode(position *Position.Position, col int, mover int) int32 {
+	var untried uint8
+	for c := 0; c < position.BoardWidth; c++ {
+		if position.CanPlay(c) {
+			untried |= 1 << c
+		}
+	}
+	t.nodes = append(t.nodes, node{col: col, mover: mover, untried: untried})
+	return int32(len(t.nodes) - 1)
+}
+
+// iterate runs one selection, expansion, playout and backup from the root,
+// playing on position as it goes
+func (t *searchTree) iterate(position *Position.Position, root int32, path []int32) []int32 {
+	current := root
+	path = append(path, current)
+
+	// Select down to a node with moves left to try
+	for {
+		n := &t.nodes[current]
+		if n.terminal || n.untried != 0 {
+			break
+		}
+		current = t.selectChild(n)
+		position.Play(t.nodes[current].col)
+		path = append(path, current)
+	}
+
+	// Expand one untried move
+	if n := &t.nodes[current]; !n.terminal {
+		col := t.randomBit(n.untried)
+		n.untried &^= 1 << col
+		mover := position.GetCurrentPlayer()
+		position.Play(col)
+		child := t.newNode(position, col, mover)
+		t.nodes[child].terminal = finished(position)
+
+		// newNode may have moved the nodes
+		n = &t.nodes[current]
+		n.children[n.n] = child
+		n.n++
+		current = child
+		path = append(path, current)
+	}
+
+	winner := t.playout(position)
+	for _, i := range path {
+		n := &t.nodes[i]
+		n.visits++
+		switch winner {
+		case n.mover:
+			n.wins++
+		case -1:
+			n.wins += 0.5
+		}
+	}
+	return path
+}
+
+// selectChild picks the child with the highest upper confidence bound
+func (t *searchTree) selectChild(n *node) int32 {
+	logVisits := math.Log(n.visits)
+	best, bestValue := n.children[0], math.Inf(-1)
+	for _, i := range n.children[:n.n] {
+		child := &t.nodes[i]
+		value := child.wins/child.visits + t.personality.Exploration*math.Sqrt(logVisits/child.visits)
+		if value > bestValue {
+			best, bestValue = i, value
+		}
+	}
+	return best
+}
+
+// playout plays position to the end and returns the winner, -1 for a draw
+func (t *searchTree) playout(position *Position.Position) int {
+	for {
+		if position.NumMoves > 0 && position.ConnectedFour(position.CurrentPositions[1-position.GetCurrentPlayer()]) {
+			return 1 - position.GetCurrentPlayer()
+		}
+		if position.NumMoves == position.BoardWidth*position.BoardHeight {
+			return -1
+		}
+		position.Play(t.playoutMove(position))
+	}
+}
+
+// playoutMove picks a random move, or with the personality's tactical chance
+// a winning or blocking one when there is
+func (t *searchTree) playoutMove(position *Position.Position) int {
+	possible := position.Possible()
+	if t.personality.Tactical > 0 && t.rng.Float64() < t.personality.Tactical {
+		if wins := position.WinningPositions(position.GetCurrentPlayer()) & possible; wins != 0 {
+			return position.MoveColumn(wins)
+		}
+		if blocks := position.WinningPositions(1-position.GetCurrentPlayer()) & possible; blocks != 0 {
+			return position.MoveColumn(blocks)
+		}
+	}
+
+	var cols uint8
+	for c := 0; c < position.BoardWidth; c++ {
+		if possible&position.ColumnMask(c) != 0 {
+			cols |= 1 << c
+		}
+	}
+	return t.randomBit(cols)
+}
+
+// randomBit returns the index of a random set bit of bits, which must not be 0
+func (t *searchTree) randomBit(bits uint8) int {
+	var cols [8]int
+	n := 0
+	for c := 0; c < 8; c++ {
+		if bits&(1<<c) != 0 {
+			cols[n] = c
+			n++
+		}
+	}
+	return cols[t.rng.Intn(n)]
+}
+
+// finished reports whether the game is over at position
+func finished(position *Position.Position) bool {
+	if position.NumMoves == position.BoardWidth*position.BoardHeight {
+		return true
+	}
+	return position.NumMoves > 0 && position.ConnectedFour(position.CurrentPositions[1-position.GetCurrentPlayer()])
+}
@@ -0,0 +1,272 @@
+package Players
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InitialRating is the Elo rating of a newly registered player
+const InitialRating = 1200
+
+// kFactor controls how far a single game moves a rating
+const kFactor = 32
+
+// botRatings holds the fixed rating of each bot setting, named after the
+// engine the bot plays with
+var botRatings = map[string]float64{
+	"default":       1800,
+	"exact":         2000,
+	"easy":          900,
+	"medium":        1300,
+	"random":        400,
+	"mcts-casual":   1100,
+	"mcts-balanced": 1400,
+	"mcts-sharp":    1600,
+}
+
+// Player is a registered account
+type Player struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Rating    float64   `json:"rating"`
+	Wins      int       `json:"wins"`
+	Losses    int       `json:"losses"`
+	Draws     int       `json:"draws"`
+	Created   time.Time `json:"created"`
+	TokenHash string    `json:"tokenHash,omitempty"`
+}
+
+// Public returns a copy of the player that is safe to send to clients
+func (p Player) Public() Player {
+	p.TokenHash = ""
+	return p
+}
+
+// Registry stores players in memory and, when path is set, in a JSON file
+type Registry struct {
+	path    string
+	players map[string]*Player
+	tokens  map[string]string // token hash -> player ID
+	mutex   sync.Mutex
+}
+
+// ErrNameTaken is returned when registering a name that is already in use
+var ErrNameTaken = errors.New("name already taken")
+
+// NewRegistry creates a Registry, loading players previously saved at path.
+// An empty path keeps players in memory only.
+func NewRegistry(path string) (*Registry, error) {
+	r := &Registry{
+		path:    path,
+		players: make(map[string]*Player),
+		tokens:  make(map[string]string),
+	}
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []*Player
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	for _, p := range saved {
+		r.players[p.ID] = p
+		r.tokens[p.TokenHash] = p.ID
+	}
+	return r, nil
+}
+
+// Register creates a player and returns it with its bearer token. Only a hash
+// of the token is kept.
+func (r *Registry) Register(name string) (Player, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Player{}, "", errors.New("name must not be empty")
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return Player{}, "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, p := range r.players {
+		if strings.EqualFold(p.Name, name) {
+			return Player{}, "", ErrNameTaken
+		}
+	}
+
+	p := &Player{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Rating:    InitialRating,
+		Created:   time.Now().UTC(),
+		TokenHash: hashToken(token),
+	}
+	r.players[p.ID] = p
+	r.tokens[p.TokenHash] = p.ID
+
+	return *p, token, r.save()
+}
+
+// Authenticate returns the player owning token
+func (r *Registry) Authenticate(token string) (Player, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	id, ok := r.tokens[hashToken(token)]
+	if !ok {
+		return Player{}, false
+	}
+	return *r.players[id], true
+}
+
+// Get returns the player with the given ID
+func (r *Registry) Get(id string) (Player, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	p, ok := r.players[id]
+	if !ok {
+		return Player{}, false
+	}
+	return *p, true
+}
+
+// Leaderboard returns up to limit players ordered by rating
+func (r *Registry) Leaderboard(limit int) []Player {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	board := make([]Player, 0, len(r.players))
+	for _, p := range r.players {
+		board = append(board, *p)
+	}
+	sort.Slice(board, func(i, j int) bool {
+		if board[i].Rating != board[j].Rating {
+			return board[i].Rating > board[j].Rating
+		}
+		return board[i].Name < board[j].Name
+	})
+
+	if limit > 0 && len(board) > limit {
+		board = board[:limit]
+	}
+	return board
+}
+
+// IsRatedBot reports whether games against the bot setting can be rated
+func IsRatedBot(setting string) bool {
+	_, ok := botRatings[setting]
+	return ok
+}
+
+// RecordBotGame updates a player's rating after a game against the bot
+// setting. score is 1 for a win, 0.5 for a draw and 0 for a loss.
+func (r *Registry) RecordBotGame(playerID string, setting string, score float64) error {
+	botRating, ok := botRatings[setting]
+	if !ok {
+		return errors.New("unknown bot setting")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	p, ok := r.players[playerID]
+	if !ok {
+		return errors.New("unknown player")
+	}
+
+	p.Rating = UpdateRating(p.Rating, botRating, score)
+	countResult(p, score)
+	return r.save()
+}
+
+// RecordGame updates both players' ratings after a game between them.
+// score is the first player's result: 1 for a win, 0.5 for a draw, 0 for a loss.
+func (r *Registry) RecordGame(firstID string, secondID string, score float64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	first, ok := r.players[firstID]
+	if !ok {
+		return errors.New("unknown player")
+	}
+	second, ok := r.players[secondID]
+	if !ok {
+		return errors.New("unknown player")
+	}
+
+	firstRating := first.Rating
+	first.Rating = UpdateRating(first.Rating, second.Rating, score)
+	second.Rating = UpdateRating(second.Rating, firstRating, 1-score)
+	countResult(first, score)
+	countResult(second, 1-score)
+	return r.save()
+}
+
+// Expected returns the expected score of a player rated a against one rated b
+func Expected(a float64, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// UpdateRating returns the new Elo rating after scoring score against opponent
+func UpdateRating(rating float64, opponent float64, score float64) float64 {
+	return rating + kFactor*(score-Expected(rating, opponent))
+}
+
+func countResult(p *Player, score float64) {
+	switch score {
+	case 1:
+		p.Wins++
+	case 0:
+		p.Losses++
+	default:
+		p.Draws++
+	}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// save writes every player to the backing file; callers must hold the mutex
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	all := make([]*Player, 0, len(r.players))
+	for _, p := range r.players {
+		all = append(all, p)
+	}
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, 0o600)
+}
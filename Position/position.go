@@ -2,6 +2,7 @@ package Position
 
 import (
 	"fmt"
+	"math/bits"
 	"sort"
 )
 
@@ -49,6 +50,12 @@ func (p *Position) getColumnOrder() []int {
 	return order
 }
 
+// Copy returns an independent copy of the position
+func (p *Position) Copy() *Position {
+	c := *p
+	return &c
+}
+
 // GetMask returns the combined board state (all pieces)
 func (p *Position) GetMask() uint64 {
 	return p.CurrentPositions[0] | p.CurrentPositions[1]
@@ -69,6 +76,90 @@ func (p *Position) BottomMask(col int) uint64 {
 	return uint64(1) << uint64(col*(p.BoardHeight+1))
 }
 
+// BottomRow returns a mask with the bottom cell of every column set
+func (p *Position) BottomRow() uint64 {
+	var mask uint64
+	for col := 0; col < p.BoardWidth; col++ {
+		mask |= p.BottomMask(col)
+	}
+	return mask
+}
+
+// BoardMask returns a mask with every cell of the board set
+func (p *Position) BoardMask() uint64 {
+	return p.BottomRow() * (uint64(1)<<p.BoardHeight - 1)
+}
+
+// ColumnMask returns a mask with every cell of col set
+func (p *Position) ColumnMask(col int) uint64 {
+	return (uint64(1)<<p.BoardHeight - 1) << uint64(col*(p.BoardHeight+1))
+}
+
+// Possible returns a mask of the cells that can be played next, one per open column
+func (p *Position) Possible() uint64 {
+	return (p.GetMask() + p.BottomRow()) & p.BoardMask()
+}
+
+// WinningPositions returns the empty cells, playable or not, that would
+// complete a four in a row for player
+func (p *Position) WinningPositions(player int) uint64 {
+	return p.winningPositions(p.CurrentPositions[player], p.GetMask())
+}
+
+// winningPositions returns the empty cells that would complete a four for
+// pieces, with mask holding every piece on the board
+func (p *Position) winningPositions(pieces, mask uint64) uint64 {
+	// vertical
+	r := (pieces << 1) & (pieces << 2) & (pieces << 3)
+
+	// horizontal and both diagonals
+	for _, shift := range p.BitShifts[1:] {
+		s := uint64(shift)
+		m := (pieces << s) & (pieces << (2 * s))
+		r |= m & (pieces << (3 * s))
+		r |= m & (pieces >> s)
+		m = (pieces >> s) & (pieces >> (2 * s))
+		r |= m & (pieces << s)
+		r |= m & (pieces >> (3 * s))
+	}
+
+	return r & (p.BoardMask() ^ mask)
+}
+
+// MoveColumn returns the column of the lowest cell set in moves
+func (p *Position) MoveColumn(moves uint64) int {
+	return bits.TrailingZeros64(moves) / (p.BoardHeight + 1)
+}
+
+// CanWinNext reports whether the player to move can complete four in a row now
+func (p *Position) CanWinNext() bool {
+	return p.WinningPositions(p.GetCurrentPlayer())&p.Possible() != 0
+}
+
+// PossibleNonLosingMoves returns the playable cells that do not let the
+// opponent win on the next move. It is 0 when every move loses. The player to
+// move must not be able to win immediately.
+func (p *Position) PossibleNonLosingMoves() uint64 {
+	possible := p.Possible()
+	opponentWin := p.WinningPositions(1 - p.GetCurrentPlayer())
+	forced := possible & opponentWin
+	if forced != 0 {
+		if forced&(forced-1) != 0 {
+			return 0 // two threats cannot both be blocked
+		}
+		possible = forced
+	}
+	// Never play directly below an opponent's winning cell
+	return possible &^ (opponentWin >> 1)
+}
+
+// MoveScore counts the winning cells the player to move would have after
+// playing move, a single bit from Possible. Higher scores are searched first.
+func (p *Position) MoveScore(move uint64) int {
+	pieces := p.CurrentPositions[p.GetCurrentPlayer()] | move
+	return bits.OnesCount64(p.winningPositions(pieces, p.GetMask()|move))
+}
+
 // CanPlay checks if a move in the given column is valid
 func (p *Position) CanPlay(col int) bool {
 	if p.NumMoves == p.BoardHeight*p.BoardWidth {
@@ -104,6 +195,17 @@ func (p *Position) Play(col int) {
 	p.LastMove = col
 }
 
+// Undo takes back the last move, which was played in col. LastMove is not
+// restored; callers that need it keep their own copy.
+func (p *Position) Undo(col int) {
+	mover := 1 - p.GetCurrentPlayer()
+	column := p.GetMask() & p.ColumnMask(col)
+	top := uint64(1) << (63 - bits.LeadingZeros64(column))
+	p.CurrentPositions[mover] ^= top
+	p.NumMoves--
+	p.LastMove = -1
+}
+
 // WinningBoardState checks if the last move created a winning alignment
 func (p *Position) WinningBoardState() bool {
 	opp := 1 - p.GetCurrentPlayer()
@@ -150,6 +252,52 @@ func (p *Position) colSort(col int) int {
 	return count
 }
 
+// MoveOrder returns columns that, played in turn from the empty board,
+// reach the position. ok is false when no game reaches it. For positions
+// with a four in a row the four may be completed before the last move.
+func (p *Position) MoveOrder() (moves []int, ok bool) {
+	var heights, target [7]int
+	mask := p.GetMask()
+	for col := 0; col < p.BoardWidth; col++ {
+		target[col] = bits.OnesCount64(mask & p.ColumnMask(col))
+	}
+
+	// Stones go in bottom up in every column, so only the interleaving of
+	// the columns is searched, remembering column heights that led nowhere
+	moves = make([]int, 0, p.NumMoves)
+	deadEnds := make(map[[7]int]bool)
+	var search func(ply int) bool
+	search = func(ply int) bool {
+		if ply == p.NumMoves {
+			return heights == target
+		}
+		if deadEnds[heights] {
+			return false
+		}
+		stones := p.CurrentPositions[ply%2]
+		for _, col := range p.ColumnOrder {
+			cell := uint64(1) << (col*(p.BoardHeight+1) + heights[col])
+			if heights[col] == target[col] || stones&cell == 0 {
+				continue
+			}
+			heights[col]++
+			moves = append(moves, col)
+			if search(ply + 1) {
+				return true
+			}
+			heights[col]--
+			moves = moves[:len(moves)-1]
+		}
+		deadEnds[heights] = true
+		return false
+	}
+
+	if !search(0) {
+		return nil, false
+	}
+	return moves, true
+}
+
 // GetSearchOrder returns columns in preferred search order
 func (p *Position) GetSearchOrder() []int {
 	var validColumns []int
@@ -159,9 +307,13 @@ func (p *Position) GetSearchOrder() []int {
 		}
 	}
 
-	// Sort by colSort score
-	sort.Slice(validColumns, func(i, j int) bool {
-		return p.colSort(validColumns[i]) > p.colSort(validColumns[j])
+	// Sort by colSort score, computed once per column
+	scores := make([]int, p.BoardWidth)
+	for _, col := range validColumns {
+		scores[col] = p.colSort(col)
+	}
+	sort.SliceStable(validColumns, func(i, j int) bool {
+		return scores[validColumns[i]] > scores[validColumns[j]]
 	})
 
 	return validColumns
@@ -0,0 +1,216 @@
+package Protocol
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"connect4/Engine"
+	"connect4/Position"
+)
+
+// Timeouts for external engines
+const (
+	handshakeTimeout = 5 * time.Second // from starting the process to uciok
+	stopGrace        = time.Second     // from stop, or the end of movetime, to bestmove
+)
+
+// External is an engine run as a separate process that speaks the protocol.
+// The process is started on the first search and restarted after it fails.
+// Searches are answered one at a time.
+type External struct {
+	name    string
+	command string
+	args    []string
+
+	// OnError, when set, is called with every failure of the process
+	OnError func(error)
+
+	mutex sync.Mutex
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string // the process's output, closed when it exits
+}
+
+// NewExternal makes an engine that runs command with args
+func NewExternal(name string, command string, args ...string) *External {
+	return &External{name: name, command: command, args: args}
+}
+
+func (e *External) Name() string { return e.name }
+
+// BestMove asks the process for its move. A failed process is killed and -1
+// returned. That includes a search cancelled through ctx that the process
+// did not answer, so its late bestmove cannot be taken for the next search's.
+func (e *External) BestMove(ctx context.Context, position *Position.Position, limits Engine.Limits) (Engine.Move, Engine.Info) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	move, info, err := e.search(ctx, position, limits)
+	if err != nil {
+		e.kill()
+		if ctx.Err() == nil && e.OnError != nil {
+			e.OnError(fmt.Errorf("engine %s: %w", e.name, err))
+		}
+	}
+	return move, info
+}
+
+// Close asks the process to quit and kills it if it does not
+func (e *External) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.cmd == nil {
+		return nil
+	}
+	e.send("quit")
+	select {
+	case <-e.drain():
+	case <-time.After(stopGrace):
+	}
+	e.kill()
+	return nil
+}
+
+func (e *External) search(ctx context.Context, position *Position.Position, limits Engine.Limits) (Engine.Move, Engine.Info, error) {
+	var info Engine.Info
+	command, err := positionCommand(position)
+	if err != nil {
+		return -1, info, err
+	}
+	if e.cmd == nil {
+		if err := e.start(); err != nil {
+			return -1, info, err
+		}
+	}
+
+	// Forget output left over from an earlier search
+	for len(e.lines) > 0 {
+		<-e.lines
+	}
+
+	// Enforce the move time when the process ignores it
+	if limits.MoveTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.MoveTime)
+		defer cancel()
+	}
+
+	if err := e.send(command); err != nil {
+		return -1, info, err
+	}
+	if err := e.send(goCommand(limits)); err != nil {
+		return -1, info, err
+	}
+
+	stopped := ctx.Done()
+	var grace <-chan time.Time
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return -1, info, errors.New("process exited")
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "info":
+				parseInfo(fields[1:], &info)
+			case "bestmove":
+				move, err := parseBestMove(fields[1:])
+				return move, info, err
+			}
+		case <-stopped:
+			stopped = nil
+			grace = time.After(stopGrace)
+			if err := e.send("stop"); err != nil {
+				return -1, info, err
+			}
+		case <-grace:
+			return -1, info, errors.New("no bestmove after stop")
+		}
+	}
+}
+
+// start runs the process and waits for its uciok
+func (e *External) start() error {
+	cmd := exec.Command(e.command, e.args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	lines := make(chan string, 64)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+		cmd.Wait()
+	}()
+	e.cmd, e.stdin, e.lines = cmd, stdin, lines
+
+	if err := e.send("uci"); err != nil {
+		return err
+	}
+	timeout := time.After(handshakeTimeout)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				return errors.New("process exited before uciok")
+			}
+			if strings.TrimSpace(line) == "uciok" {
+				return nil
+			}
+		case <-timeout:
+			return errors.New("no uciok from process")
+		}
+	}
+}
+
+// send writes one command to the process
+func (e *External) send(command string) error {
+	_, err := io.WriteString(e.stdin, command+"\n")
+	return err
+}
+
+// drain discards the process's output until it exits, closing the returned
+// channel then
+func (e *External) drain() <-chan struct{} {
+	done := make(chan struct{})
+	go func(lines chan string) {
+		for range lines {
+		}
+		close(done)
+	}(e.lines)
+	return done
+}
+
+// kill stops the process so the next search starts a new one
+func (e *External) kill() {
+	if e.cmd == nil {
+		return
+	}
+	e.stdin.Close()
+	e.cmd.Process.Kill()
+	e.drain()
+	e.cmd, e.stdin, e.lines = nil, nil, nil
+}
@@ -0,0 +1,169 @@
+// Package Protocol runs engines over a line-based text protocol modelled on
+// UCI, so bots written in any language can play on the server.
+//
+// The server writes commands to the engine's standard input, one per line:
+//
+//	uci                       identify yourself; answer "id name <name>" then "uciok"
+//	isready                   answer "readyok" once ready for commands
+//	position startpos         the empty board
+//	position moves 4453       the board after these moves, columns 1 to 7
+//	go movetime 500           search for at most 500 milliseconds
+//	go depth 10               search 10 moves ahead
+//	go nodes 20000            search at most 20000 positions or playouts
+//	stop                      answer with the best move found so far
+//	quit                      exit
+//
+// A search ends with "bestmove 3", columns again counting from 1, or
+// "bestmove none" when there is no move. Before it the engine may report
+// "info depth 8 score 2 nodes 1234", with the score from the point of view
+// of the player to move. Lines the receiver does not understand are ignored.
+package Protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"connect4/Engine"
+	"connect4/Position"
+)
+
+// FormatMoves writes columns as the digits used by the position command
+func FormatMoves(moves []int) string {
+	var b strings.Builder
+	for _, col := range moves {
+		b.WriteByte(byte('1' + col))
+	}
+	return b.String()
+}
+
+// ParseMoves reads the digits of the position command into columns
+func ParseMoves(s string) ([]int, error) {
+	moves := make([]int, 0, len(s))
+	for _, ch := range s {
+		if ch < '1' || ch > '7' {
+			return nil, fmt.Errorf("invalid column %q", ch)
+		}
+		moves = append(moves, int(ch-'1'))
+	}
+	return moves, nil
+}
+
+// positionCommand describes position for the engine
+func positionCommand(position *Position.Position) (string, error) {
+	if position.NumMoves == 0 {
+		return "position startpos", nil
+	}
+	moves, ok := position.MoveOrder()
+	if !ok {
+		return "", fmt.Errorf("no game reaches the position")
+	}
+	return "position moves " + FormatMoves(moves), nil
+}
+
+// parsePosition plays the arguments of a position command on a new position
+func parsePosition(args []string) (*Position.Position, error) {
+	position := Position.NewPosition()
+	switch {
+	case len(args) == 1 && args[0] == "startpos":
+		return position, nil
+	case len(args) >= 1 && args[0] == "moves":
+		if len(args) == 1 {
+			return position, nil
+		}
+		moves, err := ParseMoves(args[1])
+		if err != nil {
+			return nil, err
+		}
+		for _, col := range moves {
+			if !position.CanPlay(col) {
+				return nil, fmt.Errorf("column %d is full", col+1)
+			}
+			position.Play(col)
+		}
+		return position, nil
+	}
+	return nil, fmt.Errorf("invalid position command")
+}
+
+// goCommand describes limits for the engine
+func goCommand(limits Engine.Limits) string {
+	command := "go"
+	if limits.MoveTime > 0 {
+		command += fmt.Sprintf(" movetime %d", max(limits.MoveTime.Milliseconds(), 1))
+	}
+	if limits.Depth > 0 {
+		command += fmt.Sprintf(" depth %d", limits.Depth)
+	}
+	if limits.Iterations > 0 {
+		command += fmt.Sprintf(" nodes %d", limits.Iterations)
+	}
+	return command
+}
+
+// parseGo reads the arguments of a go command
+func parseGo(args []string) (Engine.Limits, error) {
+	var limits Engine.Limits
+	for i := 0; i+1 < len(args); i += 2 {
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 0 {
+			return limits, fmt.Errorf("invalid %s: %s", args[i], args[i+1])
+		}
+		switch args[i] {
+		case "movetime":
+			limits.MoveTime = time.Duration(n) * time.Millisecond
+		case "depth":
+			limits.Depth = n
+		case "nodes":
+			limits.Iterations = n
+		}
+	}
+	return limits, nil
+}
+
+// formatInfo describes a finished search
+func formatInfo(info Engine.Info) string {
+	return fmt.Sprintf("info depth %d score %d nodes %d", info.Depth, info.Score, info.Nodes)
+}
+
+// parseInfo reads the fields of an info line into info
+func parseInfo(args []string, info *Engine.Info) {
+	for i := 0; i+1 < len(args); i += 2 {
+		n, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch args[i] {
+		case "depth":
+			info.Depth = int(n)
+		case "score":
+			info.Score = int(n)
+		case "nodes":
+			info.Nodes = uint64(n)
+		}
+	}
+}
+
+// formatBestMove answers a search
+func formatBestMove(move Engine.Move) string {
+	if move < 0 {
+		return "bestmove none"
+	}
+	return fmt.Sprintf("bestmove %d", move+1)
+}
+
+// parseBestMove reads the argument of a bestmove line
+func parseBestMove(args []string) (Engine.Move, error) {
+	if len(args) == 0 {
+		return -1, fmt.Errorf("bestmove without a move")
+	}
+	if args[0] == "none" {
+		return -1, nil
+	}
+	col, err := strconv.Atoi(args[0])
+	if err != nil || col < 1 || col > 7 {
+		return -1, fmt.Errorf("invalid bestmove %q", args[0])
+	}
+	return Engine.Move(col - 1), nil
+}
@@ -0,0 +1,111 @@
+package Protocol
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"connect4/Engine"
+	"connect4/Position"
+)
+
+// lineWriter writes whole lines from the command loop and the search at once
+type lineWriter struct {
+	w     io.Writer
+	mutex sync.Mutex
+}
+
+func (l *lineWriter) println(line string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	fmt.Fprintln(l.w, line)
+}
+
+// Serve answers the commands read from r with engine, writing replies to w,
+// until quit or the end of r. Searches run in the background so stop can
+// interrupt them; other commands wait for the search to finish. Invalid
+// commands are answered with "info string <error>".
+func Serve(r io.Reader, w io.Writer, engine Engine.Engine) error {
+	out := &lineWriter{w: w}
+	position := Position.NewPosition()
+
+	var running *search
+	defer func() { running.stop() }()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "uci":
+			out.println("id name " + engine.Name())
+			out.println("uciok")
+		case "isready":
+			out.println("readyok")
+		case "position":
+			running.wait()
+			p, err := parsePosition(fields[1:])
+			if err != nil {
+				out.println("info string " + err.Error())
+				continue
+			}
+			position = p
+		case "go":
+			running.wait()
+			limits, err := parseGo(fields[1:])
+			if err != nil {
+				out.println("info string " + err.Error())
+				continue
+			}
+			running = startSearch(engine, position.Copy(), limits, out)
+		case "stop":
+			running.stop()
+		case "quit":
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// search is a search running in the background
+type search struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startSearch runs engine on position, writing its result to out when done
+func startSearch(engine Engine.Engine, position *Position.Position, limits Engine.Limits, out *lineWriter) *search {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &search{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		move, info := engine.BestMove(ctx, position, limits)
+		out.println(formatInfo(info))
+		out.println(formatBestMove(move))
+	}()
+	return s
+}
+
+// stop interrupts the search and waits for its result to be written
+func (s *search) stop() {
+	if s == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+// wait waits for the search to finish on its own
+func (s *search) wait() {
+	if s == nil {
+		return
+	}
+	<-s.done
+	s.cancel()
+}
@@ -0,0 +1,245 @@
+package Puzzles
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+
+	"connect4/Position"
+	"connect4/Solver"
+
+	"github.com/google/uuid"
+)
+
+// Difficulty is a coarse bucket derived from a puzzle's rating
+type Difficulty string
+
+const (
+	Easy   Difficulty = "easy"
+	Medium Difficulty = "medium"
+	Hard   Difficulty = "hard"
+)
+
+// Puzzle is a reachable position in which the player to move has exactly one
+// first move that forces four in a row within MovesToWin moves
+type Puzzle struct {
+	ID         string     `json:"id"`
+	Date       string     `json:"date,omitempty"`
+	Moves      []int      `json:"moves"` // columns played from the empty board
+	MovesToWin int        `json:"movesToWin"`
+	Solution   int        `json:"solution"`
+	Rating     int        `json:"rating"`
+	Difficulty Difficulty `json:"difficulty"`
+}
+
+// Verdict is the result of checking a move sequence against a puzzle
+type Verdict struct {
+	Correct bool   `json:"correct"`
+	Solved  bool   `json:"solved"`
+	Message string `json:"message"`
+	Reply   int    `json:"reply"` // opponent's best defence, -1 if none
+}
+
+// ErrNotFound is returned when no puzzle could be generated
+var ErrNotFound = errors.New("no puzzle found")
+
+// ErrIllegalMove is returned by Check for a line that cannot be played
+var ErrIllegalMove = errors.New("illegal move in sequence")
+
+// Generator searches random reachable positions for puzzles
+type Generator struct {
+	Rand     *rand.Rand
+	MinPlies int
+	MaxPlies int
+	Attempts int
+}
+
+// NewGenerator creates a Generator seeded with seed
+func NewGenerator(seed int64) *Generator {
+	return &Generator{
+		Rand:     rand.New(rand.NewSource(seed)),
+		MinPlies: 6,
+		MaxPlies: 20,
+		Attempts: 5000,
+	}
+}
+
+// Position rebuilds the puzzle position from its move list
+func (p *Puzzle) Position() *Position.Position {
+	pos := Position.NewPosition()
+	for _, col := range p.Moves {
+		pos.Play(col)
+	}
+	return pos
+}
+
+// searchDepth returns the number of plies needed to see a win in movesToWin
+func searchDepth(movesToWin int) int {
+	return 2*movesToWin - 1
+}
+
+// Generate returns a puzzle whose unique first move wins in exactly movesToWin
+// moves. It gives up with ctx's error once ctx is done.
+func (g *Generator) Generate(ctx context.Context, movesToWin int) (Puzzle, error) {
+	if movesToWin < 1 {
+		return Puzzle{}, errors.New("movesToWin must be positive")
+	}
+
+	for i := 0; i < g.Attempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return Puzzle{}, err
+		}
+		moves, pos := g.randomPosition()
+		if pos == nil {
+			continue
+		}
+
+		solution, decoys, ok, err := uniqueWin(ctx, pos, movesToWin)
+		if err != nil {
+			return Puzzle{}, err
+		}
+		if !ok {
+			continue
+		}
+
+		rating := Rate(movesToWin, decoys)
+		return Puzzle{
+			ID:         uuid.New().String(),
+			Moves:      moves,
+			MovesToWin: movesToWin,
+			Solution:   solution,
+			Rating:     rating,
+			Difficulty: DifficultyFor(rating),
+		}, nil
+	}
+
+	return Puzzle{}, ErrNotFound
+}
+
+// randomPosition plays random moves that never end the game
+func (g *Generator) randomPosition() ([]int, *Position.Position) {
+	pos := Position.NewPosition()
+	plies := g.MinPlies + g.Rand.Intn(g.MaxPlies-g.MinPlies+1)
+	moves := make([]int, 0, plies)
+
+	for len(moves) < plies {
+		var candidates []int
+		for col := 0; col < pos.BoardWidth; col++ {
+			if pos.CanPlay(col) && !pos.IsWinningMove(col, pos.CurrentPositions[pos.GetCurrentPlayer()]) {
+				candidates = append(candidates, col)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, nil
+		}
+
+		col := candidates[g.Rand.Intn(len(candidates))]
+		pos.Play(col)
+		moves = append(moves, col)
+	}
+
+	return moves, pos
+}
+
+// uniqueWin reports the only column that wins within movesToWin moves, and how
+// many of the remaining columns do not lose within the search horizon
+func uniqueWin(ctx context.Context, pos *Position.Position, movesToWin int) (int, int, bool, error) {
+	solution := -1
+	decoys := 0
+
+	results, err := Solver.ScoreMovesContext(ctx, pos, searchDepth(movesToWin))
+	if err != nil {
+		return -1, 0, false, err
+	}
+	for _, result := range results {
+		switch {
+		case result.Score > 0 && Solver.MovesToWin(pos, result.Score) <= movesToWin:
+			if solution != -1 || Solver.MovesToWin(pos, result.Score) != movesToWin {
+				return -1, 0, false, nil
+			}
+			solution = result.Col
+		case result.Score >= 0:
+			decoys++
+		}
+	}
+
+	return solution, decoys, solution != -1, nil
+}
+
+// Rate scores a puzzle: longer wins and more plausible alternatives are harder
+func Rate(movesToWin int, decoys int) int {
+	return 600 + 250*(movesToWin-1) + 75*decoys
+}
+
+// DifficultyFor buckets a rating
+func DifficultyFor(rating int) Difficulty {
+	switch {
+	case rating < 900:
+		return Easy
+	case rating < 1300:
+		return Medium
+	default:
+		return Hard
+	}
+}
+
+// Check replays line from the puzzle position. Even indices are the solver's
+// moves, odd indices the defender's. Every solver move must keep a forced win
+// within the moves that remain. It gives up with ctx's error once ctx is done.
+func (p *Puzzle) Check(ctx context.Context, line []int) (Verdict, error) {
+	pos := p.Position()
+
+	for i, col := range line {
+		if col < 0 || col >= pos.BoardWidth || !pos.CanPlay(col) {
+			return Verdict{}, ErrIllegalMove
+		}
+
+		if i%2 == 1 {
+			pos.Play(col)
+			continue
+		}
+
+		remaining := p.MovesToWin - i/2
+		if remaining < 1 {
+			return Verdict{Message: "Too many moves", Reply: -1}, nil
+		}
+
+		score, err := Solver.ScoreMoveContext(ctx, pos, col, searchDepth(remaining))
+		if err != nil {
+			return Verdict{}, err
+		}
+		if score <= 0 || Solver.MovesToWin(pos, score) > remaining {
+			return Verdict{Message: "That move does not force a win", Reply: -1}, nil
+		}
+
+		pos.Play(col)
+		if pos.WinningBoardState() {
+			return Verdict{Correct: true, Solved: true, Message: "Puzzle solved", Reply: -1}, nil
+		}
+	}
+
+	if len(line)%2 == 0 {
+		return Verdict{Correct: true, Message: "Correct so far", Reply: -1}, nil
+	}
+
+	reply, err := bestDefence(ctx, pos, p.MovesToWin-len(line)/2)
+	if err != nil {
+		return Verdict{}, err
+	}
+	return Verdict{Correct: true, Message: "Correct so far", Reply: reply}, nil
+}
+
+// bestDefence picks the reply that delays the loss the longest
+func bestDefence(ctx context.Context, pos *Position.Position, remaining int) (int, error) {
+	results, err := Solver.ScoreMovesContext(ctx, pos, searchDepth(remaining))
+	if err != nil {
+		return -1, err
+	}
+	best := Solver.Result{Score: -pos.BoardWidth * pos.BoardHeight, Col: -1}
+	for _, result := range results {
+		if result.Score > best.Score {
+			best = result
+		}
+	}
+	return best.Col, nil
+}
@@ -0,0 +1,146 @@
+package Puzzles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dailyPrefix starts the ID of every daily puzzle, followed by its date
+const dailyPrefix = "daily-"
+
+// Store keeps generated puzzles in memory and, when path is set, in a JSON file
+type Store struct {
+	path    string
+	puzzles map[string]Puzzle
+	daily   map[string]string // date -> puzzle ID
+	mutex   sync.Mutex
+}
+
+// NewStore creates a Store, loading any puzzles previously saved at path.
+// An empty path keeps puzzles in memory only.
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		puzzles: make(map[string]Puzzle),
+		daily:   make(map[string]string),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []Puzzle
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	for _, p := range saved {
+		s.add(p)
+	}
+	return s, nil
+}
+
+// Get returns the puzzle with the given ID
+func (s *Store) Get(id string) (Puzzle, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	p, ok := s.puzzles[id]
+	return p, ok
+}
+
+// Add stores a puzzle
+func (s *Store) Add(p Puzzle) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.add(p)
+	return s.save()
+}
+
+// Cached returns the puzzle of day if it has already been generated
+func (s *Store) Cached(day time.Time) (Puzzle, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id, ok := s.daily[day.UTC().Format("2006-01-02")]
+	if !ok {
+		return Puzzle{}, false
+	}
+	return s.puzzles[id], true
+}
+
+// Daily returns the puzzle for the given day, generating it on first request.
+// The generator is seeded from the date and the ID is made from it, so every
+// server picks the same puzzle under the same ID. Other puzzles can be read
+// while it is generated.
+func (s *Store) Daily(ctx context.Context, day time.Time) (Puzzle, error) {
+	date := day.UTC().Format("2006-01-02")
+	if p, ok := s.Cached(day); ok {
+		return p, nil
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(date))
+	seed := int64(h.Sum64())
+
+	// Rotate between win in 2, 3 and 4 from one day to the next
+	movesToWin := 2 + day.UTC().YearDay()%3
+
+	p, err := NewGenerator(seed).Generate(ctx, movesToWin)
+	if err != nil {
+		return Puzzle{}, err
+	}
+	p.ID = dailyPrefix + date
+	p.Date = date
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.add(p)
+	return p, s.save()
+}
+
+// DailyDay returns the day of a daily puzzle from its ID
+func DailyDay(id string) (time.Time, bool) {
+	date, ok := strings.CutPrefix(id, dailyPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	day, err := time.Parse("2006-01-02", date)
+	return day, err == nil
+}
+
+func (s *Store) add(p Puzzle) {
+	s.puzzles[p.ID] = p
+	if p.Date != "" {
+		s.daily[p.Date] = p.ID
+	}
+}
+
+// save writes every puzzle to the backing file; callers must hold the mutex
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	all := make([]Puzzle, 0, len(s.puzzles))
+	for _, p := range s.puzzles {
+		all = append(all, p)
+	}
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
@@ -0,0 +1,68 @@
+package RateLimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter is a set of token buckets, one per key (an IP address or a player)
+type Limiter struct {
+	rate    float64 // tokens added per second
+	burst   float64
+	buckets map[string]*bucket
+	lastGC  time.Time
+	mutex   sync.Mutex
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// idleAfter is how long an untouched bucket is kept; by then it is full anyway
+const idleAfter = 10 * time.Minute
+
+// NewLimiter allows perMinute requests per key on average, with bursts of up to burst
+func NewLimiter(perMinute float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    perMinute / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		lastGC:  time.Now(),
+	}
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it returns
+// false and how long until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.lastGC) > idleAfter {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > idleAfter {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastGC = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
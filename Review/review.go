@@ -0,0 +1,227 @@
+package Review
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connect4/Position"
+	"connect4/Solver"
+)
+
+// Classification grades a move by how much it changed the exact score
+type Classification string
+
+const (
+	Best       Classification = "best"
+	Inaccuracy Classification = "inaccuracy"
+	Mistake    Classification = "mistake"
+	Blunder    Classification = "blunder"
+
+	// Undecided moves were not classified because the search could not
+	// prove the result of the move played or of the best one
+	Undecided Classification = "undecided"
+)
+
+// DefaultDepth is the search depth used for each reviewed position
+const DefaultDepth = 10
+
+// ProofBudget is how long the proof-number search may spend on the moves of
+// a position whose result the search to DefaultDepth left open. It settles
+// most middlegames; openings usually stay undecided.
+const ProofBudget = 500 * time.Millisecond
+
+// inaccuracyMargin is the largest score drop that still counts as an inaccuracy
+const inaccuracyMargin = 2
+
+// Annotation describes one move of a reviewed game
+type Annotation struct {
+	Ply            int            `json:"ply"`
+	Player         int            `json:"player"`
+	Column         int            `json:"column"`
+	Score          int            `json:"score"`      // 0 unless proven exactly
+	BestColumn     int            `json:"bestColumn"` // -1 when undecided
+	BestScore      int            `json:"bestScore"`  // 0 unless proven exactly
+	Classification Classification `json:"classification"`
+}
+
+// moveResult is what a review knows about one move: its exact score, or
+// failing that just whether it wins, draws or loses
+type moveResult struct {
+	col     int
+	score   int
+	exact   bool
+	outcome int  // 1, 0 or -1 for a win, draw or loss
+	known   bool // outcome holds
+}
+
+// Annotate replays moves from the empty board and scores every move against
+// the best alternative available in the same position. Scores come from a
+// search to searchDepth, and when that leaves results open the proof-number
+// search decides what it can within ProofBudget. Moves are classified only
+// when the results of the move played and the best one are known; a move
+// that keeps the result is best when the margin cannot be measured. It gives
+// up with ctx's error once ctx is done.
+func Annotate(ctx context.Context, moves []int, searchDepth int) ([]Annotation, error) {
+	position := Position.NewPosition()
+	annotations := make([]Annotation, 0, len(moves))
+
+	for ply, col := range moves {
+		if col < 0 || col >= position.BoardWidth || !position.CanPlay(col) {
+			return nil, errors.New("illegal move in game history")
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		annotation := Annotation{
+			Ply:            ply,
+			Player:         position.GetCurrentPlayer(),
+			Column:         col,
+			BestColumn:     -1,
+			Classification: Undecided,
+		}
+
+		// The move played comes first so it is the first one proved
+		var results []moveResult
+		for _, c := range append([]int{col}, position.ColumnOrder...) {
+			if !position.CanPlay(c) || (c == col && len(results) > 0) {
+				continue
+			}
+			score, exact, err := scoreMove(ctx, position, c, searchDepth)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, moveResult{col: c, score: score, exact: exact, outcome: outcome(score), known: exact})
+		}
+		played := results[0]
+		if played.exact {
+			annotation.Score = played.score
+		}
+
+		// Wins are proven within the search when they can be, so an
+		// undecided move can only be worse than one
+		best, allExact := -1, true
+		for i, r := range results {
+			if !r.exact {
+				allExact = false
+			} else if best == -1 || r.score > results[best].score {
+				best = i
+			}
+		}
+		if best != -1 && (allExact || results[best].score > 0) {
+			annotation.BestColumn = results[best].col
+			annotation.BestScore = results[best].score
+			if played.exact {
+				annotation.Classification = Classify(results[best].score, played.score)
+			} else {
+				// Only the move played is left to prove
+				results = []moveResult{played, results[best]}
+			}
+		}
+
+		if annotation.Classification == Undecided {
+			if err := prove(ctx, position, results); err != nil {
+				return nil, err
+			}
+			classifyOutcomes(&annotation, results)
+		}
+
+		annotations = append(annotations, annotation)
+		position.Play(col)
+	}
+
+	return annotations, nil
+}
+
+// scoreMove returns the score of playing col from the mover's point of view
+// and whether it is exact. A search that stops short of the end of the game
+// without finding a win or loss scores 0 but proves nothing.
+func scoreMove(ctx context.Context, position *Position.Position, col int, searchDepth int) (int, bool, error) {
+	if position.IsWinningMove(col, position.CurrentPositions[position.GetCurrentPlayer()]) {
+		return Solver.GetWinScore(position), true, nil
+	}
+
+	child := position.Copy()
+	child.Play(col)
+	score, _, _, err := Solver.Search(ctx, child, Solver.Options{Depth: searchDepth - 1})
+	if err != nil {
+		return 0, false, err
+	}
+	empty := child.BoardWidth*child.BoardHeight - child.NumMoves
+	return -score, score != 0 || searchDepth-1 >= empty, nil
+}
+
+// prove decides the outcome of every move in results not known yet with the
+// proof-number search, the first first, until ProofBudget runs out
+func prove(ctx context.Context, position *Position.Position, results []moveResult) error {
+	proofCtx, cancel := context.WithTimeout(ctx, ProofBudget)
+	defer cancel()
+
+	for i := range results {
+		if results[i].known {
+			continue
+		}
+		child := position.Copy()
+		child.Play(results[i].col)
+		score, _, _, err := Solver.Search(proofCtx, child, Solver.Options{Backend: Solver.ProofNumber})
+		if err != nil {
+			// Out of budget leaves the rest undecided
+			return ctx.Err()
+		}
+		results[i].outcome, results[i].known = -score, true
+	}
+	return nil
+}
+
+// classifyOutcomes classifies the move played, results[0], by outcome alone:
+// a worse result than the best move's is a blunder, the same one best
+func classifyOutcomes(annotation *Annotation, results []moveResult) {
+	best, allKnown := -1, true
+	for i, r := range results {
+		if !r.known {
+			allKnown = false
+		} else if best == -1 || r.outcome > results[best].outcome {
+			best = i
+		}
+	}
+	if !results[0].known || best == -1 || (!allKnown && results[best].outcome < 1) {
+		return
+	}
+
+	if annotation.BestColumn == -1 {
+		annotation.BestColumn = results[best].col
+	}
+	annotation.Classification = Best
+	if results[0].outcome < results[best].outcome {
+		annotation.Classification = Blunder
+	}
+}
+
+// Classify compares the score of the played move with the best score.
+// Giving away a win or a draw is a blunder; otherwise the size of the drop
+// decides between an inaccuracy and a mistake.
+func Classify(bestScore int, playedScore int) Classification {
+	switch {
+	case playedScore >= bestScore:
+		return Best
+	case outcome(playedScore) < outcome(bestScore):
+		return Blunder
+	case bestScore-playedScore <= inaccuracyMargin:
+		return Inaccuracy
+	default:
+		return Mistake
+	}
+}
+
+// outcome reduces a score to loss (-1), draw (0) or win (1)
+func outcome(score int) int {
+	switch {
+	case score > 0:
+		return 1
+	case score < 0:
+		return -1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,85 @@
+package Solver
+
+import (
+	"math/bits"
+
+	"connect4/Position"
+)
+
+// MaxEval bounds heuristic scores. Inside the search win scores are scaled by
+// evalScale, so any proven result outranks every heuristic one.
+const (
+	MaxEval   = 15
+	evalScale = MaxEval + 1
+)
+
+// Evaluator scores a position the search did not finish, from the point of
+// view of the player to move. Scores above MaxEval or below -MaxEval are
+// clamped. Positions handed to an evaluator have no four in a row and no
+// immediate win for the player to move.
+type Evaluator interface {
+	// Name identifies the evaluator. Searches with different names do not
+	// share transposition table entries.
+	Name() string
+	Evaluate(position *Position.Position) int
+}
+
+// DefaultEvaluator is used when a search does not name an evaluator
+var DefaultEvaluator Evaluator = ThreatEvaluator{Threat: 2, ParityBonus: 2, Center: 1}
+
+// ZeroEvaluator scores every unfinished position as a draw, which is how the
+// solver behaved before evaluators existed
+type ZeroEvaluator struct{}
+
+func (ZeroEvaluator) Name() string { return "zero" }
+
+func (ZeroEvaluator) Evaluate(*Position.Position) int { return 0 }
+
+// ThreatEvaluator counts the empty cells that would complete a four for each
+// player. Threats on the rows that favour their owner (odd rows for the first
+// player, even rows for the second, counting from 1 at the bottom) earn the
+// parity bonus on top. Pieces in the centre column add Center each.
+type ThreatEvaluator struct {
+	Threat      int
+	ParityBonus int
+	Center      int
+}
+
+func (e ThreatEvaluator) Name() string {
+	return "threat"
+}
+
+func (e ThreatEvaluator) Evaluate(position *Position.Position) int {
+	me := position.GetCurrentPlayer()
+	return e.side(position, me) - e.side(position, 1-me)
+}
+
+// side scores one player's threats and centre pieces
+func (e ThreatEvaluator) side(position *Position.Position, player int) int {
+	pieces := position.CurrentPositions[player]
+	threats := position.WinningPositions(player)
+
+	// Rows 1, 3 and 5 are bits 0, 2 and 4 of each column
+	oddRows := position.BottomRow() * 0b010101
+	good := oddRows
+	if player == 1 {
+		good = position.BoardMask() &^ oddRows
+	}
+
+	centre := position.ColumnMask(position.BoardWidth / 2)
+	return e.Threat*bits.OnesCount64(threats) +
+		e.ParityBonus*bits.OnesCount64(threats&good) +
+		e.Center*bits.OnesCount64(pieces&centre)
+}
+
+// evaluate runs eval on position, clamped to ±MaxEval
+func evaluate(eval Evaluator, position *Position.Position) int {
+	score := eval.Evaluate(position)
+	if score > MaxEval {
+		return MaxEval
+	}
+	if score < -MaxEval {
+		return -MaxEval
+	}
+	return score
+}
@@ -0,0 +1,88 @@
+package Solver
+
+import "connect4/Position"
+
+// Ordering chooses the heuristics that rank moves inside the search. Moves
+// are always ranked by the threats they create, then by how central they are,
+// and the transposition table's move goes ahead of all of them. The
+// heuristics break the remaining ties.
+type Ordering struct {
+	Name    string
+	Killers bool // moves that caused a cutoff at the same ply
+	History bool // columns that caused many deep cutoffs at the same ply
+}
+
+var (
+	StaticOrdering  = Ordering{Name: "static"}
+	KillerOrdering  = Ordering{Name: "killers", Killers: true}
+	HistoryOrdering = Ordering{Name: "history", History: true}
+
+	KillerHistoryOrdering = Ordering{Name: "killers+history", Killers: true, History: true}
+
+	// DefaultOrdering is used when a search does not choose an ordering. On
+	// the bench positions (go run ./Test bench) neither heuristic has saved
+	// nodes over threats and centre alone, so it uses neither.
+	DefaultOrdering = StaticOrdering
+)
+
+// Orderings lists the built-in orderings, for benchmarking them against each other
+var Orderings = []Ordering{StaticOrdering, KillerOrdering, HistoryOrdering, KillerHistoryOrdering}
+
+// maxPlies is the number of moves in a full game
+const maxPlies = 42
+
+// Order scores are packed so each part only decides between moves the ones
+// before it left tied: threats, centre distance, killers, then history
+const (
+	threatShift   = 16
+	centreShift   = 13
+	killerBonus   = 1 << 12
+	historyLimit  = 1<<11 - 1
+	hashMoveScore = 1 << 30
+)
+
+// moveOrder is the state the ordering heuristics learn during one search
+type moveOrder struct {
+	Ordering
+	killers [maxPlies][2]int // columns plus 1, 0 when empty, most recent first
+	history [maxPlies][maxColumns]int
+}
+
+// score ranks playing col, which places move, at the position's ply
+func (o *moveOrder) score(position *Position.Position, col int, move uint64) int {
+	ply := position.NumMoves
+	centre := maxColumns/2 - abs(col-maxColumns/2)
+	score := position.MoveScore(move)<<threatShift | centre<<centreShift
+	if o.Killers {
+		switch col + 1 {
+		case o.killers[ply][0]:
+			score += killerBonus
+		case o.killers[ply][1]:
+			score += killerBonus / 2
+		}
+	}
+	if o.History {
+		score += min(o.history[ply][col], historyLimit)
+	}
+	return score
+}
+
+// cutoff records that playing col at the position's ply refuted it with
+// depth plies left to search
+func (o *moveOrder) cutoff(position *Position.Position, col int, depth int) {
+	ply := position.NumMoves
+	if o.Killers && o.killers[ply][0] != col+1 {
+		o.killers[ply][1] = o.killers[ply][0]
+		o.killers[ply][0] = col + 1
+	}
+	if o.History {
+		o.history[ply][col] += depth * depth
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
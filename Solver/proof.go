@@ -0,0 +1,282 @@
+package Solver
+
+import (
+	"context"
+	"sync"
+
+	"connect4/Position"
+)
+
+// Backend is the algorithm a search runs
+type Backend int
+
+const (
+	AlphaBeta   Backend = iota // negamax with alpha-beta pruning
+	ProofNumber                // depth-first proof-number search, which only tells wins, draws and losses apart
+)
+
+const (
+	proofInfinity  = 1<<32 - 1
+	proofSlotBytes = 24 // the memory used by one proofSlot
+)
+
+// DefaultProofTableBytes is the size of the proof-number table unless SetProofTableSize is called
+const DefaultProofTableBytes = 48 << 20
+
+var (
+	proofTableBytes = DefaultProofTableBytes
+	proofTables     = make(chan *proofTable, 1)
+	proofTableOnce  sync.Once
+)
+
+// SetProofTableSize sets the memory used by the table of proof-number
+// searches. They share one table and run one at a time. It must be called
+// before the first search.
+func SetProofTableSize(bytes int) {
+	proofTableBytes = bytes
+}
+
+// proofEntry holds the proof and disproof numbers of a position from the
+// point of view of the player to move: phi is the work left to show the
+// player to move reaches the goal, delta the work left to show it does not
+type proofEntry struct {
+	phi, delta int
+}
+
+// proofSlot is a stored proofEntry. Work counts the nodes searched below the
+// position, so the more expensive of two positions is kept when they collide.
+type proofSlot struct {
+	key        uint64
+	phi, delta uint32
+	work       uint64
+}
+
+// proofTable maps positions to their numbers. Positions share the
+// transposition table's keys, and each hashes to one of 1<<bits buckets of
+// two slots.
+type proofTable struct {
+	slots []proofSlot
+	bits  uint
+	used  int
+}
+
+// newProofTable creates a table using at most the given number of bytes
+func newProofTable(bytes int) *proofTable {
+	bits := uint(1)
+	for 2*proofSlotBytes<<(bits+1) <= bytes {
+		bits++
+	}
+	return &proofTable{slots: make([]proofSlot, 2<<bits), bits: bits}
+}
+
+// acquireProofTable waits for the proof table and returns it empty, or nil
+// once ctx is done. The caller hands it back to proofTables.
+func acquireProofTable(ctx context.Context) *proofTable {
+	proofTableOnce.Do(func() {
+		proofTables <- newProofTable(proofTableBytes)
+	})
+	select {
+	case t := <-proofTables:
+		clear(t.slots)
+		t.used = 0
+		return t
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func (t *proofTable) bucket(key uint64) []proofSlot {
+	i := 2 * ((key * 0x9e3779b97f4a7c15) >> (64 - t.bits))
+	return t.slots[i : i+2]
+}
+
+func (t *proofTable) get(key uint64) (proofEntry, bool) {
+	for _, s := range t.bucket(key) {
+		if s.key == key && s.work != 0 {
+			return proofEntry{int(s.phi), int(s.delta)}, true
+		}
+	}
+	return proofEntry{}, false
+}
+
+// put stores e for key, over the same position or the cheaper slot of the bucket
+func (t *proofTable) put(key uint64, e proofEntry, work uint64) {
+	b := t.bucket(key)
+	victim := &b[0]
+	if b[1].key == key || (b[0].key != key && b[1].work < b[0].work) {
+		victim = &b[1]
+	}
+	if victim.work == 0 {
+		t.used++
+	}
+	*victim = proofSlot{key: key, phi: uint32(e.phi), delta: uint32(e.delta), work: work}
+}
+
+// prover runs a df-pn search for one goal: that attacker wins. The defender
+// reaches the goal by drawing or winning.
+type prover struct {
+	ctx      context.Context
+	stats    *Stats
+	table    *proofTable
+	attacker int
+	salt     uint64 // keeps the two goals apart in the table
+}
+
+// proofSearch decides position with two proof-number searches: whether the
+// player to move wins, and if not whether the opponent does. The score is 1,
+// 0 or -1 for a win, draw or loss; the move keeps the result.
+func proofSearch(ctx context.Context, position *Position.Position, stats *Stats) (int, int, error) {
+	// A game that is already over
+	if position.ConnectedFour(position.CurrentPositions[1-position.GetCurrentPlayer()]) {
+		return -1, -1, nil
+	}
+	if TieGame(position) {
+		return 0, -1, nil
+	}
+	if wins := position.WinningPositions(position.GetCurrentPlayer()) & position.Possible(); wins != 0 {
+		return 1, position.MoveColumn(wins), nil
+	}
+
+	table := acquireProofTable(ctx)
+	if table == nil {
+		return 0, -1, ctx.Err()
+	}
+	defer func() { proofTables <- table }()
+	p := &prover{ctx: ctx, stats: stats, table: table}
+	defer func() { stats.TTSize = p.table.used }()
+
+	me := position.GetCurrentPlayer()
+	if wins, col := p.prove(position, me); stats.aborted {
+		return 0, -1, ctx.Err()
+	} else if wins {
+		return 1, col, nil
+	}
+
+	draws, col := p.prove(position, 1-me)
+	if stats.aborted {
+		return 0, -1, ctx.Err()
+	}
+	if draws {
+		return 0, col, nil
+	}
+	if col == -1 {
+		col = position.MoveColumn(position.Possible())
+	}
+	return -1, col, nil
+}
+
+// prove reports whether the player to move at position reaches the goal of
+// attacker winning or the defender holding, with a move that does
+func (p *prover) prove(position *Position.Position, attacker int) (bool, int) {
+	p.attacker = attacker
+	p.salt = uint64(attacker+1) << 56
+
+	phi, _, _ := p.mid(position, proofInfinity, proofInfinity)
+	if p.stats.aborted || phi != 0 {
+		return false, -1
+	}
+
+	next := position.PossibleNonLosingMoves()
+	for _, col := range position.ColumnOrder {
+		if next&position.ColumnMask(col) != 0 && p.child(position, col).delta == 0 {
+			return true, col
+		}
+	}
+	return true, -1
+}
+
+// terminal returns the numbers of a position decided without searching it
+func (p *prover) terminal(position *Position.Position) (proofEntry, bool) {
+	reached := proofEntry{0, proofInfinity}
+	failed := proofEntry{proofInfinity, 0}
+
+	if TieGame(position) {
+		if position.GetCurrentPlayer() == p.attacker {
+			return failed, true
+		}
+		return reached, true
+	}
+	if position.CanWinNext() {
+		return reached, true
+	}
+	if position.PossibleNonLosingMoves() == 0 {
+		return failed, true
+	}
+	return proofEntry{}, false
+}
+
+// child returns the stored numbers of the position after col is played,
+// or 1 and 1 for a position not seen yet
+func (p *prover) child(position *Position.Position, col int) proofEntry {
+	// After col the opponent is to move and their pieces are unchanged
+	mask := position.GetMask()
+	mask |= mask + position.BottomMask(col)
+	key := mask + position.CurrentPositions[1-position.GetCurrentPlayer()]
+
+	if e, ok := p.table.get(key ^ p.salt); ok {
+		return e
+	}
+	return proofEntry{1, 1}
+}
+
+// mid expands position until its phi reaches thPhi or its delta reaches
+// thDelta, and returns its numbers and the nodes searched
+func (p *prover) mid(position *Position.Position, thPhi, thDelta int) (int, int, uint64) {
+	stats := p.stats
+	stats.Nodes++
+	if stats.Nodes%cancelCheckInterval == 0 && p.ctx.Err() != nil {
+		stats.aborted = true
+	}
+	if stats.aborted {
+		return 0, 0, 0
+	}
+
+	key := position.GetKey() ^ p.salt
+	if e, ok := p.terminal(position); ok {
+		p.table.put(key, e, 1)
+		return e.phi, e.delta, 1
+	}
+
+	work := uint64(1)
+
+	next := position.PossibleNonLosingMoves()
+	for {
+		// The player to move needs one child where the opponent fails and
+		// fails only when every child succeeds for the opponent. Thresholds
+		// are widened by a quarter to cut down on re-expanding children.
+		phi, delta := proofInfinity, 0
+		best, bestPhi, secondDelta := -1, 0, proofInfinity
+		for _, col := range position.ColumnOrder {
+			if next&position.ColumnMask(col) == 0 {
+				continue
+			}
+			c := p.child(position, col)
+			delta = min(delta+c.phi, proofInfinity)
+			if c.delta < phi {
+				secondDelta = phi
+				phi = c.delta
+				best, bestPhi = col, c.phi
+			} else if c.delta < secondDelta {
+				secondDelta = c.delta
+			}
+		}
+
+		if phi >= thPhi || delta >= thDelta {
+			p.table.put(key, proofEntry{phi, delta}, work)
+			return phi, delta, work
+		}
+
+		childPhi := min(thDelta+bestPhi-delta, proofInfinity)
+		childDelta := min(thPhi, secondDelta+secondDelta/4+1)
+
+		lastMove := position.LastMove
+		position.Play(best)
+		_, _, childWork := p.mid(position, childPhi, childDelta)
+		position.Undo(best)
+		position.LastMove = lastMove
+		if stats.aborted {
+			return 0, 0, 0
+		}
+		work += childWork
+	}
+}
@@ -3,54 +3,196 @@ package Solver
 import (
 	"connect4/Position"
 	"connect4/Transposition"
+	"context"
+	"hash/fnv"
 	"math"
+	"math/rand"
+	"sync"
+	"time"
 )
 
-// TTEntry represents an entry in the transposition table
-type TTEntry struct {
-	Value int
-	Col   int
-	UB    bool // Upper bound flag
-	LB    bool // Lower bound flag
-}
-
 type Result struct {
 	Score int
 	Col   int
 }
 
+// Stats describes the work done by a search
+type Stats struct {
+	Nodes    uint64 // positions visited by Negamax
+	TTSize   int    // entries in the shared transposition table after the search
+	TTHits   uint64 // lookups that found an entry deep enough to use
+	TTMisses uint64
+	Depth    int  // deepest search completed
+	aborted  bool // set once the search context is done
+}
+
+// Options configure a search
+type Options struct {
+	Weak      bool      // only tell wins, draws and losses apart
+	Depth     int       // plies searched before the evaluator takes over
+	Evaluator Evaluator // nil uses DefaultEvaluator
+	Table     *Transposition.Table // nil uses the shared table
+	Ordering  Ordering  // zero value uses DefaultOrdering
+
+	// Rand, when set, has an iterative search pick at random among the
+	// moves with the best score instead of taking the first. With a
+	// Temperature above 0 that is also the chance of picking among the
+	// second best moves instead; those searches skip aspiration windows so
+	// every root move is scored exactly.
+	Rand        *rand.Rand
+	Temperature float64
+
+	// Backend is the search algorithm. ProofNumber ignores every option
+	// above and scores 1, 0 or -1.
+	Backend Backend
+
+	// Iterative searches depth 1, 2, ... up to Depth, each seeding the move
+	// order of the next. When the context ends the deepest finished result is
+	// returned instead of an error.
+	Iterative bool
+	OnDepth   func(DepthResult) // called after each finished depth of an iterative search
+}
+
+// DepthResult reports one finished depth of an iterative search
+type DepthResult struct {
+	Depth   int
+	Score   int
+	Col     int
+	Nodes   uint64
+	Elapsed time.Duration
+}
+
+// aspirationWindow is how far, in search units, the next depth's first window
+// reaches either side of the previous depth's score
+const aspirationWindow = 4
+
+// searcher holds what stays fixed while one search runs
+type searcher struct {
+	ctx   context.Context
+	table *Transposition.Table
+	eval  Evaluator
+	salt  uint64 // keeps entries of different evaluators apart in the table
+	stats *Stats
+	order moveOrder
+}
+
+// cancelCheckInterval is how many nodes are searched between context checks
+const cancelCheckInterval = 1024
+
+// DefaultTableBytes is the size of the shared transposition table unless SetTableSize is called
+const DefaultTableBytes = 64 << 20
+
+var (
+	sharedTable *Transposition.Table
+	tableOnce   sync.Once
+)
+
+// SetTableSize sets the memory used by the transposition table shared by all
+// searches. It must be called before the first search.
+func SetTableSize(bytes int) {
+	tableOnce.Do(func() {
+		sharedTable = Transposition.NewTable(bytes)
+	})
+}
+
+// Table returns the transposition table shared by all searches. Entries
+// record the depth they were searched to, so they stay valid from one search
+// to the next.
+func Table() *Transposition.Table {
+	SetTableSize(DefaultTableBytes)
+	return sharedTable
+}
+
 // GetWinScore calculates the win score based on the current position
 func GetWinScore(position *Position.Position) int {
 	return ((position.BoardWidth*position.BoardHeight + 1) - position.NumMoves) / 2
 }
 
+// MovesToWin converts a positive score into the number of moves the current
+// player needs to complete four in a row
+func MovesToWin(position *Position.Position, score int) int {
+	return GetWinScore(position) - score + 1
+}
+
 // TieGame checks if the game is a tie
 func TieGame(position *Position.Position) bool {
 	return position.NumMoves == position.BoardHeight*position.BoardWidth
 }
 
-// Negamax implements the negamax algorithm with alpha-beta pruning and transposition table
-func Negamax(position *Position.Position, alpha, beta int, transpositionTable *Transposition.TranspositionTable, maxDepth int) (int, int) {
+// maxColumns is the board width; Position's four in a row checks assume 7 columns
+const maxColumns = 7
+
+// moveList holds the moves of a node, highest score first. Moves with equal
+// scores keep the order they were added in.
+type moveList struct {
+	cols   [maxColumns]int
+	scores [maxColumns]int
+	n      int
+}
+
+func (m *moveList) add(col, score int) {
+	i := m.n
+	for ; i > 0 && m.scores[i-1] < score; i-- {
+		m.cols[i] = m.cols[i-1]
+		m.scores[i] = m.scores[i-1]
+	}
+	m.cols[i] = col
+	m.scores[i] = score
+	m.n++
+}
+
+// winScore is GetWinScore in search units
+func winScore(position *Position.Position) int {
+	return GetWinScore(position) * evalScale
+}
+
+// negamax implements the negamax algorithm with alpha-beta pruning and transposition table.
+// Moves are played on position and taken back before returning, so a search allocates nothing per node.
+// Scores are in search units: win scores times evalScale, or heuristic scores at the horizon.
+// When the context is done the search unwinds without storing anything and the result is meaningless.
+func (s *searcher) negamax(position *Position.Position, alpha, beta int, maxDepth int) (int, int) {
+	stats := s.stats
+	stats.Nodes++
+	if stats.Nodes%cancelCheckInterval == 0 && s.ctx.Err() != nil {
+		stats.aborted = true
+	}
+	if stats.aborted {
+		return 0, -1
+	}
 	if maxDepth == 0 {
-		return 0, 0
+		return evaluate(s.eval, position), -1
 	}
 
-	
-	key := position.GetKey()
+	transpositionTable := s.table
+	key := position.GetKey() ^ s.salt
+	alphaOrig := alpha
 
-	// Check transposition table
-	if entry, exists := transpositionTable.Get(key); exists {
-		cachedEntry := entry.(TTEntry)
-		if cachedEntry.LB {
-			if cachedEntry.Value > alpha {
-				alpha = cachedEntry.Value
+	// Check transposition table; entries from shallower searches are only trusted when
+	// proven, but their move is still searched first
+	hashMove := -1
+	entry, exists := transpositionTable.Get(key)
+	if exists {
+		hashMove = entry.Col
+	}
+	if exists && (entry.Depth >= maxDepth || proven(entry)) {
+		stats.TTHits++
+		switch entry.Bound {
+		case Transposition.Exact:
+			return entry.Value, entry.Col
+		case Transposition.Lower:
+			if entry.Value > alpha {
+				alpha = entry.Value
 			}
-			if alpha >= beta {
-				return cachedEntry.Value, cachedEntry.Col
+		case Transposition.Upper:
+			if entry.Value < beta {
+				beta = entry.Value
 			}
-		} else {
-			return cachedEntry.Value, cachedEntry.Col
 		}
+		if alpha >= beta {
+			return entry.Value, entry.Col
+		}
+	} else {
+		stats.TTMisses++
 	}
 
 	// Check for terminal states
@@ -64,85 +206,372 @@ func Negamax(position *Position.Position, alpha, beta int, transpositionTable *T
 		prevPlayer = 0
 	}
 	if position.ConnectedFour(position.CurrentPositions[prevPlayer]) {
-		return -1 * GetWinScore(position), position.LastMove
+		return -1 * winScore(position), position.LastMove
 	}
 
 	// Look for immediate win
-	for _, col := range position.GetSearchOrder() {
-		if position.CanPlay(col) {
-			if position.IsWinningMove(col, position.CurrentPositions[position.GetCurrentPlayer()]) {
-				return GetWinScore(position), col
-			}
-		}
+	possible := position.Possible()
+	if wins := position.WinningPositions(position.GetCurrentPlayer()) & possible; wins != 0 {
+		return winScore(position), position.MoveColumn(wins)
+	}
+
+	// Skip moves that hand the opponent an immediate win
+	next := position.PossibleNonLosingMoves()
+	if next == 0 {
+		// Whatever we play, the opponent wins with their next move
+		return -(position.BoardWidth*position.BoardHeight - position.NumMoves) / 2 * evalScale, position.MoveColumn(possible)
 	}
 
 	//if maxDepth > 3 {
 		//return concurrentNegamax(position, alpha, beta, transpositionTable, maxDepth)
 	//}
 
+	// Order moves after the table's move from an earlier search, centre
+	// first among equals
+	var moves moveList
+	for _, col := range position.ColumnOrder {
+		if move := next & position.ColumnMask(col); move != 0 {
+			score := s.order.score(position, col, move)
+			if col == hashMove {
+				score = hashMoveScore
+			}
+			moves.add(col, score)
+		}
+	}
+
 	bestCol := -1
 	bestScore := math.MinInt32
 
-	// Recursive search
-	for _, col := range position.GetSearchOrder() {
-		if position.CanPlay(col) {
-			// Create a copy of the position and make the move
-			newPosition := Position.NewPosition()
-			newPosition.BoardHeight = position.BoardHeight
-			newPosition.BoardWidth = position.BoardWidth
-			newPosition.NumMoves = position.NumMoves
-			newPosition.CurrentPositions = [2]uint64{position.CurrentPositions[0], position.CurrentPositions[1]}
-			newPosition.BitShifts = position.BitShifts
-			newPosition.ColumnOrder = position.ColumnOrder
-			newPosition.Play(col)
-
-			// Recursive call with negated alpha/beta
-			score, _ := Negamax(newPosition, -beta, -alpha, transpositionTable, maxDepth-1)
-			score = -score
-
-			// Beta cutoff
-			if score >= beta {
-				transpositionTable.Put(key, TTEntry{
-					Value: score,
-					Col:   col,
-					LB:    true,
-				})
-				return score, col
-			}
+	// Recursive search, playing and taking back moves in place
+	lastMove := position.LastMove
+	for _, col := range moves.cols[:moves.n] {
+		position.Play(col)
 
-			// Update alpha
-			if score > alpha {
-				alpha = score
-				bestCol = col
-				transpositionTable.Put(key, TTEntry{
-					Value: score,
-					Col:   bestCol,
-				})
-			} else if score > bestScore {
-				bestScore = score
-				bestCol = col
-			}
+		// Recursive call with negated alpha/beta
+		score, _ := s.negamax(position, -beta, -alpha, maxDepth-1)
+		score = -score
+
+		position.Undo(col)
+		position.LastMove = lastMove
+		if stats.aborted {
+			return 0, -1
+		}
+
+		// Beta cutoff
+		if score >= beta {
+			s.order.cutoff(position, col, maxDepth)
+			transpositionTable.Put(key, Transposition.Entry{
+				Value: score,
+				Col:   col,
+				Depth: maxDepth,
+				Bound: Transposition.Lower,
+			})
+			return score, col
+		}
+
+		// Update alpha
+		if score > bestScore {
+			bestScore = score
+			bestCol = col
+		}
+		if score > alpha {
+			alpha = score
 		}
 	}
 
+	bound := Transposition.Upper
+	if alpha > alphaOrig {
+		bound = Transposition.Exact
+	}
+	transpositionTable.Put(key, Transposition.Entry{
+		Value: alpha,
+		Col:   bestCol,
+		Depth: maxDepth,
+		Bound: bound,
+	})
 	return alpha, bestCol
 }
 
+// proven reports whether an entry holds regardless of search depth. Leaves at
+// the horizon score at most MaxEval, so a lower bound above that can only come
+// from forced wins, and likewise an upper bound below -MaxEval.
+func proven(entry Transposition.Entry) bool {
+	if entry.Value > MaxEval {
+		return entry.Bound != Transposition.Upper
+	}
+	if entry.Value < -MaxEval {
+		return entry.Bound != Transposition.Lower
+	}
+	return false
+}
 
+// tableSalt derives the key salt for an evaluator. Keys use the low 49 bits,
+// so the salt lives in the top byte.
+func tableSalt(eval Evaluator) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(eval.Name()))
+	return h.Sum64() << 56
+}
 
 // Solve uses iterative deepening with Negamax to find the best move
 func Solve(position *Position.Position, weak bool, loopIters int, searchDepth int) (int, int) {
-	minVal := -(position.BoardWidth*position.BoardHeight - position.NumMoves) / 2
-	maxVal := (position.BoardWidth*position.BoardHeight + 1 - position.NumMoves) / 2
-	bestMove := -1
+	score, move, _ := SolveStats(position, weak, loopIters, searchDepth)
+	return score, move
+}
+
+// SolveStats is Solve that also reports how much work the search did
+func SolveStats(position *Position.Position, weak bool, loopIters int, searchDepth int) (int, int, Stats) {
+	score, move, stats, _ := SolveContext(context.Background(), position, weak, loopIters, searchDepth)
+	return score, move, stats
+}
 
-	if weak {
-		minVal = -3
-		maxVal = 3
+// SolveContext is SolveStats that gives up with ctx's error once ctx is done
+func SolveContext(ctx context.Context, position *Position.Position, weak bool, loopIters int, searchDepth int) (int, int, Stats, error) {
+	return Search(ctx, position, Options{Weak: weak, Depth: searchDepth})
+}
+
+// Search finds the score and best move of position. Scores count how early
+// the player to move wins (see GetWinScore) or loses; positions the search
+// could not decide within opts.Depth score 0, but their evaluation still
+// guides the choice of move.
+func Search(ctx context.Context, position *Position.Position, opts Options) (int, int, Stats, error) {
+	var stats Stats
+	eval := opts.Evaluator
+	if eval == nil {
+		eval = DefaultEvaluator
+	}
+	s := &searcher{
+		ctx:   ctx,
+		table: Table(),
+		eval:  eval,
+		salt:  tableSalt(eval),
+		stats: &stats,
+	}
+	if opts.Table != nil {
+		s.table = opts.Table
+	}
+	s.order.Ordering = opts.Ordering
+	if opts.Ordering == (Ordering{}) {
+		s.order.Ordering = DefaultOrdering
 	}
 
-	tt := Transposition.NewTranspositionTable(1000000) // One million entries
+	// Search a copy so the caller's position is never seen half-played
+	position = position.Copy()
 
+	if opts.Backend == ProofNumber {
+		score, move, err := proofSearch(ctx, position, &stats)
+		return score, move, stats, err
+	}
+
+	minVal := -(position.BoardWidth*position.BoardHeight - position.NumMoves) / 2 * evalScale
+	maxVal := (position.BoardWidth*position.BoardHeight + 1 - position.NumMoves) / 2 * evalScale
+
+	if opts.Weak {
+		minVal = -3 * evalScale
+		maxVal = 3 * evalScale
+	}
+
+	if !opts.Iterative {
+		score, move := s.bisect(position, opts.Depth, minVal, maxVal)
+		if stats.aborted {
+			return 0, -1, stats, ctx.Err()
+		}
+		stats.Depth = opts.Depth
+		stats.TTSize = s.table.Len()
+		return resultScore(score), move, stats, nil
+	}
+
+	// Searches that break ties score the root moves as they go
+	search := s.bisect
+	var roots, finished rootScores
+	if opts.Rand != nil {
+		search = func(position *Position.Position, depth int, alpha, beta int) (int, int) {
+			return s.root(position, depth, alpha, beta, opts.Temperature == 0, &roots)
+		}
+	}
+
+	start := time.Now()
+	empty := position.BoardWidth*position.BoardHeight - position.NumMoves
+	score, bestMove := 0, -1
+	for depth := 1; depth <= opts.Depth; depth++ {
+		// Aspiration: look near the last score first, widen if it lies outside
+		lo, hi := minVal, maxVal
+		if depth > 1 && (opts.Rand == nil || opts.Temperature == 0) {
+			lo = max(minVal, score-aspirationWindow)
+			hi = min(maxVal, score+aspirationWindow)
+		}
+		r, move := search(position, depth, lo, hi)
+		if !stats.aborted && r <= lo && lo > minVal {
+			r, move = search(position, depth, minVal, lo)
+		} else if !stats.aborted && r >= hi && hi < maxVal {
+			r, move = search(position, depth, hi, maxVal)
+		}
+		if stats.aborted {
+			break
+		}
+
+		score, bestMove = r, move
+		finished = roots
+		stats.Depth = depth
+		if opts.OnDepth != nil {
+			opts.OnDepth(DepthResult{
+				Depth:   depth,
+				Score:   resultScore(score),
+				Col:     bestMove,
+				Nodes:   stats.Nodes,
+				Elapsed: time.Since(start),
+			})
+		}
+
+		// A proven result does not change with more depth
+		if score > MaxEval || score < -MaxEval || depth >= empty {
+			break
+		}
+	}
+
+	if stats.Depth == 0 {
+		stats.TTSize = s.table.Len()
+		return 0, -1, stats, ctx.Err()
+	}
+	if opts.Rand != nil {
+		bestMove = finished.pick(bestMove, opts.Rand, opts.Temperature)
+	}
+	stats.TTSize = s.table.Len()
+	return resultScore(score), bestMove, stats, nil
+}
+
+// rootScores are the root moves of a search with their scores. Scores at or
+// below the window the move was searched with are only upper bounds.
+type rootScores struct {
+	cols, scores [maxColumns]int
+	n            int
+}
+
+func (r *rootScores) add(col int, score int) {
+	r.cols[r.n], r.scores[r.n] = col, score
+	r.n++
+}
+
+// pick returns one of the moves with the best score at random, or with the
+// chance temperature one of the second best, and move when there are none
+func (r *rootScores) pick(move int, rng *rand.Rand, temperature float64) int {
+	if r.n == 0 {
+		return move
+	}
+	best, second := math.MinInt, math.MinInt
+	for _, score := range r.scores[:r.n] {
+		if score > best {
+			best, second = score, best
+		} else if score < best && score > second {
+			second = score
+		}
+	}
+	target := best
+	if temperature > 0 && second != math.MinInt && rng.Float64() < temperature {
+		target = second
+	}
+
+	var picks []int
+	for i, score := range r.scores[:r.n] {
+		if score == target {
+			picks = append(picks, r.cols[i])
+		}
+	}
+	return picks[rng.Intn(len(picks))]
+}
+
+// root is negamax at the root that records the score of every move in
+// scores. With ties set the window only drops to just below the best score
+// so far, which is enough to find every move equal to it; otherwise every
+// move is scored within [alpha, beta].
+func (s *searcher) root(position *Position.Position, depth int, alpha, beta int, ties bool, scores *rootScores) (int, int) {
+	scores.n = 0
+	prevPlayer := 1 - position.GetCurrentPlayer()
+	if TieGame(position) || position.ConnectedFour(position.CurrentPositions[prevPlayer]) {
+		return s.negamax(position, alpha, beta, depth)
+	}
+
+	// Immediate wins are all equal, as are moves when every one loses
+	possible := position.Possible()
+	wins := position.WinningPositions(position.GetCurrentPlayer()) & possible
+	next := position.PossibleNonLosingMoves()
+	if wins != 0 || next == 0 {
+		score := winScore(position)
+		moves := wins
+		if wins == 0 {
+			score = -(position.BoardWidth*position.BoardHeight - position.NumMoves) / 2 * evalScale
+			moves = possible
+		}
+		for _, col := range position.ColumnOrder {
+			if moves&position.ColumnMask(col) != 0 {
+				scores.add(col, score)
+			}
+		}
+		return score, scores.cols[0]
+	}
+
+	key := position.GetKey() ^ s.salt
+	hashMove := -1
+	if entry, exists := s.table.Get(key); exists {
+		hashMove = entry.Col
+	}
+	var moves moveList
+	for _, col := range position.ColumnOrder {
+		if move := next & position.ColumnMask(col); move != 0 {
+			score := s.order.score(position, col, move)
+			if col == hashMove {
+				score = hashMoveScore
+			}
+			moves.add(col, score)
+		}
+	}
+
+	alphaOrig := alpha
+	bestCol := -1
+	bestScore := math.MinInt32
+	lastMove := position.LastMove
+	for _, col := range moves.cols[:moves.n] {
+		lower := alphaOrig
+		if ties && bestCol != -1 {
+			lower = max(alphaOrig, bestScore-1)
+		}
+
+		position.Play(col)
+		score, _ := s.negamax(position, -beta, -lower, depth-1)
+		score = -score
+		position.Undo(col)
+		position.LastMove = lastMove
+		if s.stats.aborted {
+			return 0, -1
+		}
+
+		scores.add(col, score)
+		if score >= beta {
+			s.table.Put(key, Transposition.Entry{Value: score, Col: col, Depth: depth, Bound: Transposition.Lower})
+			return score, col
+		}
+		if score > bestScore {
+			bestScore = score
+			bestCol = col
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	bound := Transposition.Upper
+	if alpha > alphaOrig {
+		bound = Transposition.Exact
+	}
+	s.table.Put(key, Transposition.Entry{Value: alpha, Col: bestCol, Depth: depth, Bound: bound})
+	return alpha, bestCol
+}
+
+// bisect narrows [minVal, maxVal] down to the score of position at depth with
+// null window searches. The move is the one that proved the final lower bound,
+// or the last one searched if the score never rose above minVal.
+func (s *searcher) bisect(position *Position.Position, depth int, minVal, maxVal int) (int, int) {
+	bestMove, lastMove := -1, -1
 	for minVal < maxVal {
 		mid := minVal + (maxVal-minVal)/2
 		
@@ -153,22 +582,82 @@ func Solve(position *Position.Position, weak bool, loopIters int, searchDepth in
 		}
 
 		// Use a null window search
-		r, move := Negamax(position, mid, mid+1, tt, searchDepth)
+		r, move := s.negamax(position, mid, mid+1, depth)
+		if s.stats.aborted {
+			return 0, -1
+		}
 
 		if r <= mid {
 			maxVal = r
 		} else {
 			minVal = r
+			bestMove = move
 		}
-		
-		bestMove = move
+		lastMove = move
 	}
 
+	if bestMove == -1 {
+		bestMove = lastMove
+	}
 	return minVal, bestMove
 }
 
+// resultScore converts a score in search units to a result. Heuristic scores
+// are not results and are reported as undecided.
+func resultScore(score int) int {
+	if score >= -MaxEval && score <= MaxEval {
+		return 0
+	}
+	return score / evalScale
+}
+
+// ScoreMove returns the score of playing col from the current player's point of view
+func ScoreMove(position *Position.Position, col int, searchDepth int) int {
+	score, _ := ScoreMoveContext(context.Background(), position, col, searchDepth)
+	return score
+}
+
+// ScoreMoveContext is ScoreMove that gives up with ctx's error once ctx is done
+func ScoreMoveContext(ctx context.Context, position *Position.Position, col int, searchDepth int) (int, error) {
+	if position.IsWinningMove(col, position.CurrentPositions[position.GetCurrentPlayer()]) {
+		return GetWinScore(position), nil
+	}
+
+	child := position.Copy()
+	child.Play(col)
+	score, _, _, err := SolveContext(ctx, child, false, 0, searchDepth-1)
+	return -score, err
+}
+
+// ScoreMoves scores every playable column of the position in search order
+func ScoreMoves(position *Position.Position, searchDepth int) []Result {
+	results, _ := ScoreMovesContext(context.Background(), position, searchDepth)
+	return results
+}
+
+// ScoreMovesContext is ScoreMoves that gives up with ctx's error once ctx is done
+func ScoreMovesContext(ctx context.Context, position *Position.Position, searchDepth int) ([]Result, error) {
+	var results []Result
+	for _, col := range position.ColumnOrder {
+		if position.CanPlay(col) {
+			score, err := ScoreMoveContext(ctx, position, col, searchDepth)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, Result{Score: score, Col: col})
+		}
+	}
+	return results, nil
+}
+
+// BestMove analyzes the position and returns the best move with its score
+// and search statistics. It fails with ctx's error if ctx is done first.
+func BestMove(ctx context.Context, position *Position.Position) (int, int, Stats, error) {
+	return SolveContext(ctx, position, false, 5, 10)
+}
+
 // MakeBestMove analyzes the position and returns the best move
 func MakeBestMove(position *Position.Position) int {
-	_, bestMove := Solve(position, false, 5, 10)
+	_, bestMove, _, _ := BestMove(context.Background(), position)
 	return bestMove
 }
\ No newline at end of file
@@ -0,0 +1,354 @@
+package SolverPool
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"connect4/Engine"
+	"connect4/Position"
+	"connect4/Solver"
+
+	"github.com/google/uuid"
+)
+
+// Priority orders queued jobs; higher priorities run first
+type Priority int
+
+const (
+	PriorityPuzzle   Priority = iota // puzzle generation and other background work
+	PriorityAnalysis                 // reviews and spectator evaluations
+	PriorityLive                     // moves in games being played
+)
+
+// Status is the state of a job
+type Status string
+
+const (
+	StatusQueued  Status = "queued"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+)
+
+var (
+	ErrQueueFull = errors.New("solver queue is full")
+	ErrStopped   = errors.New("solver pool stopped")
+)
+
+// keepFinished is how long finished jobs can still be looked up by ID
+const keepFinished = 5 * time.Minute
+
+// liveShare is the part of the queue, one in liveShare places, that only
+// PriorityLive jobs may fill, so analysis cannot crowd out games being played
+const liveShare = 4
+
+// Task is the work of a job. It should give up once ctx is done.
+type Task func(ctx context.Context) (interface{}, error)
+
+// Job is a unit of work. Jobs with the same non-empty Key that are queued or
+// running at the same time share one run and one Future.
+type Job struct {
+	Key      string
+	Priority Priority
+	Task     Task
+}
+
+// SolveResult is the value of a job made by Solve
+type SolveResult struct {
+	Score    int           `json:"score"`
+	Col      int           `json:"column"`
+	Depth    int           `json:"depth"`
+	Stats    Solver.Stats  `json:"-"`
+	Duration time.Duration `json:"-"`
+}
+
+// Solve makes a job that solves position the way Solver.SolveContext does.
+// The position is copied, so the caller may keep playing on it.
+func Solve(position *Position.Position, weak bool, loopIters int, searchDepth int, priority Priority) Job {
+	position = position.Copy()
+	return Job{
+		Key:      fmt.Sprintf("solve:%x:%t:%d", position.GetKey(), weak, searchDepth),
+		Priority: priority,
+		Task: func(ctx context.Context) (interface{}, error) {
+			start := time.Now()
+			score, col, stats, err := Solver.SolveContext(ctx, position, weak, loopIters, searchDepth)
+			if err != nil {
+				return nil, err
+			}
+			return SolveResult{Score: score, Col: col, Depth: stats.Depth, Stats: stats, Duration: time.Since(start)}, nil
+		},
+	}
+}
+
+// MoveResult is the value of a job made by EngineMove
+type MoveResult struct {
+	Engine   string        `json:"engine"`
+	Col      int           `json:"column"`
+	Info     Engine.Info   `json:"info"`
+	Duration time.Duration `json:"-"`
+}
+
+// EngineMove makes a job that asks engine for its move in position. The
+// position is copied, so the caller may keep playing on it.
+func EngineMove(engine Engine.Engine, position *Position.Position, limits Engine.Limits, priority Priority) Job {
+	position = position.Copy()
+	return Job{
+		Key: fmt.Sprintf("engine:%s:%x:%d:%d:%d:%d", engine.Name(), position.GetKey(),
+			limits.Depth, limits.MoveTime.Milliseconds(), limits.Iterations, limits.Seed),
+		Priority: priority,
+		Task: func(ctx context.Context) (interface{}, error) {
+			start := time.Now()
+			move, info := engine.BestMove(ctx, position, limits)
+			if move == -1 && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return MoveResult{Engine: engine.Name(), Col: int(move), Info: info, Duration: time.Since(start)}, nil
+		},
+	}
+}
+
+// Future is the pending result of a job
+type Future struct {
+	ID string
+
+	job      Job
+	index    int // position in the queue, -1 once taken off it
+	seq      uint64
+	status   Status
+	done     chan struct{}
+	value    interface{}
+	err      error
+	finished time.Time
+}
+
+// Done is closed once the result is available
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result returns the job's value and error. It must only be called after Done is closed.
+func (f *Future) Result() (interface{}, error) {
+	return f.value, f.err
+}
+
+// Wait blocks until the result is available, timeout passes or ctx is done.
+// It reports whether the job has finished.
+func (f *Future) Wait(ctx context.Context, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-f.done:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Pool runs jobs on a fixed number of workers
+type Pool struct {
+	queue     jobQueue
+	maxQueued int
+	byKey     map[string]*Future // queued or running jobs
+	byID      map[string]*Future // every job not yet expired
+	running   int
+	seq       uint64
+	stopped   bool
+	ctx       context.Context
+	stop      context.CancelFunc
+	mutex     sync.Mutex
+	wake      *sync.Cond
+}
+
+// New starts a pool with the given number of workers that holds at most
+// maxQueued jobs waiting to run, a quarter of them reserved for PriorityLive
+func New(workers int, maxQueued int) *Pool {
+	ctx, stop := context.WithCancel(context.Background())
+	p := &Pool{
+		maxQueued: maxQueued,
+		byKey:     make(map[string]*Future),
+		byID:      make(map[string]*Future),
+		ctx:       ctx,
+		stop:      stop,
+	}
+	p.wake = sync.NewCond(&p.mutex)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues job, or joins the identical job already queued or running.
+// Joining raises the queued job to the higher of the two priorities.
+func (p *Pool) Submit(job Job) (*Future, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.stopped {
+		return nil, ErrStopped
+	}
+	p.expire()
+
+	if job.Key != "" {
+		if f, ok := p.byKey[job.Key]; ok {
+			if f.index >= 0 && job.Priority > f.job.Priority {
+				f.job.Priority = job.Priority
+				heap.Fix(&p.queue, f.index)
+			}
+			return f, nil
+		}
+	}
+
+	limit := p.maxQueued
+	if job.Priority < PriorityLive {
+		limit -= p.maxQueued / liveShare
+	}
+	if len(p.queue) >= limit {
+		return nil, ErrQueueFull
+	}
+
+	p.seq++
+	f := &Future{
+		ID:     uuid.New().String(),
+		job:    job,
+		seq:    p.seq,
+		status: StatusQueued,
+		done:   make(chan struct{}),
+	}
+	heap.Push(&p.queue, f)
+	p.byID[f.ID] = f
+	if job.Key != "" {
+		p.byKey[job.Key] = f
+	}
+	p.wake.Signal()
+	return f, nil
+}
+
+// Lookup returns a job by ID and its current status
+func (p *Pool) Lookup(id string) (*Future, Status, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.expire()
+	f, ok := p.byID[id]
+	if !ok {
+		return nil, "", false
+	}
+	return f, f.status, true
+}
+
+// Queued returns the number of jobs waiting for a worker
+func (p *Pool) Queued() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.queue)
+}
+
+// Running returns the number of jobs being worked on
+func (p *Pool) Running() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.running
+}
+
+// Stop cancels running jobs and fails queued ones with ErrStopped
+func (p *Pool) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.stopped {
+		return
+	}
+	p.stopped = true
+	p.stop()
+	for len(p.queue) > 0 {
+		f := heap.Pop(&p.queue).(*Future)
+		p.finish(f, nil, ErrStopped)
+	}
+	p.wake.Broadcast()
+}
+
+// work runs jobs until the pool is stopped
+func (p *Pool) work() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for {
+		for len(p.queue) == 0 && !p.stopped {
+			p.wake.Wait()
+		}
+		if p.stopped {
+			return
+		}
+
+		f := heap.Pop(&p.queue).(*Future)
+		f.status = StatusRunning
+		p.running++
+		p.mutex.Unlock()
+
+		value, err := f.job.Task(p.ctx)
+
+		p.mutex.Lock()
+		p.running--
+		p.finish(f, value, err)
+	}
+}
+
+// finish publishes a job's result. The caller holds the mutex.
+func (p *Pool) finish(f *Future, value interface{}, err error) {
+	f.value, f.err = value, err
+	f.status = StatusDone
+	f.finished = time.Now()
+	if f.job.Key != "" && p.byKey[f.job.Key] == f {
+		delete(p.byKey, f.job.Key)
+	}
+	close(f.done)
+}
+
+// expire forgets jobs that finished more than keepFinished ago. The caller holds the mutex.
+func (p *Pool) expire() {
+	for id, f := range p.byID {
+		if f.status == StatusDone && time.Since(f.finished) > keepFinished {
+			delete(p.byID, id)
+		}
+	}
+}
+
+// jobQueue is a heap of futures, highest priority first and oldest first within a priority
+type jobQueue []*Future
+
+func (q jobQueue) Len() int { return len(q) }
+
+func (q jobQueue) Less(i, j int) bool {
+	if q[i].job.Priority != q[j].job.Priority {
+		return q[i].job.Priority > q[j].job.Priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *jobQueue) Push(x interface{}) {
+	f := x.(*Future)
+	f.index = len(*q)
+	*q = append(*q, f)
+}
+
+func (q *jobQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	f := old[n-1]
+	old[n-1] = nil
+	f.index = -1
+	*q = old[:n-1]
+	return f
+}
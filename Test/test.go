@@ -2,16 +2,24 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"testing"
+	"time"
+	"connect4/Engine"
 	"connect4/Position"
+	"connect4/Protocol"
 	"connect4/Solver"
+	"connect4/Transposition"
 )
 
-// TestSolver tests the Connect Four solver against a file of test positions
-func TestSolver(testfile string) {
+// TestSolver tests the Connect Four solver against a file of test positions.
+// The proof-number backend only decides the result, so it is checked against
+// the sign of the expected score.
+func TestSolver(testfile string, backend Solver.Backend) {
 	failedTests := 0
 	movesToResult := make(map[string]int)
 	
@@ -74,7 +82,13 @@ func TestSolver(testfile string) {
 		pos.CurrentPositions = [2]uint64{player1Bs, player2Bs}
 
 		// Run solver
-		result, _ := Solver.Solve(pos, false, 8, 25)
+		var result int
+		if backend == Solver.ProofNumber {
+			result, _, _, _ = Solver.Search(context.Background(), pos, Solver.Options{Backend: backend})
+			expectedResult = sign(expectedResult)
+		} else {
+			result, _ = Solver.Solve(pos, false, 8, 25)
+		}
 		
 		fmt.Printf("Position after moves %s:\n", moves)
 		pos.PrintBoard()
@@ -92,11 +106,141 @@ func TestSolver(testfile string) {
 	fmt.Printf("%d/%d tests passed\n", totalTests-failedTests, totalTests)
 }
 
+func sign(x int) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+// benchPositions are early middlegames, searched to benchDepth
+var benchPositions = []string{"", "4453", "44443322", "3246313", "573154743", "13712"}
+
+const benchDepth = 12
+
+// BenchmarkSearch measures depth-limited searches with ordering on a cold
+// private table and reports the time, heap allocations and nodes per run over
+// benchPositions
+func BenchmarkSearch(ordering Solver.Ordering) testing.BenchmarkResult {
+	table := Transposition.NewTable(16 << 20)
+	positions := make([]*Position.Position, len(benchPositions))
+	for i, moves := range benchPositions {
+		positions[i] = Position.NewPosition()
+		for _, ch := range moves {
+			positions[i].Play(int(ch - '1'))
+		}
+	}
+
+	return testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		var nodes uint64
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			table.Clear()
+			b.StartTimer()
+			for _, pos := range positions {
+				_, _, stats, _ := Solver.Search(context.Background(), pos, Solver.Options{Depth: benchDepth, Table: table, Ordering: ordering})
+				nodes += stats.Nodes
+			}
+		}
+		b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+		b.ReportMetric(float64(nodes)/b.Elapsed().Seconds(), "nodes/s")
+	})
+}
+
+// CheckEngine asks an external engine for a move in each of benchPositions
+// and checks that it answers with a legal one
+func CheckEngine(command string, args []string) {
+	engine := Protocol.NewExternal("external", command, args...)
+	defer engine.Close()
+	var failure error
+	engine.OnError = func(err error) { failure = err }
+
+	passed := 0
+	for _, moves := range benchPositions {
+		pos := Position.NewPosition()
+		for _, ch := range moves {
+			pos.Play(int(ch - '1'))
+		}
+
+		failure = nil
+		move, info := engine.BestMove(context.Background(), pos, Engine.Limits{MoveTime: 500 * time.Millisecond})
+		switch {
+		case failure != nil:
+			fmt.Printf("❌ Position %q: %v\n", moves, failure)
+		case move < 0 || !pos.CanPlay(int(move)):
+			fmt.Printf("❌ Position %q: illegal move %d\n", moves, move+1)
+		default:
+			fmt.Printf("✓ Position %q: bestmove %d (depth %d, score %d)\n", moves, move+1, info.Depth, info.Score)
+			passed++
+		}
+	}
+	fmt.Printf("%d/%d positions answered\n", passed, len(benchPositions))
+}
+
+// seedPlies is how many moves CheckSeeds has an engine play against itself
+const seedPlies = 12
+
+// CheckSeeds has each seeded solver engine play the opening against itself
+// twice with one seed, checking the games match, and once with another
+func CheckSeeds() {
+	play := func(engine Engine.Engine, seed int64) string {
+		pos := Position.NewPosition()
+		var moves strings.Builder
+		for i := 0; i < seedPlies; i++ {
+			move, _ := engine.BestMove(context.Background(), pos, Engine.Limits{Seed: seed + int64(pos.NumMoves)})
+			pos.Play(int(move))
+			moves.WriteByte(byte('1' + move))
+		}
+		return moves.String()
+	}
+
+	for _, name := range []string{"easy", "medium", Engine.Default} {
+		engine, _ := Engine.Get(name)
+		first, again, other := play(engine, 1), play(engine, 1), play(engine, 2)
+		if first != again {
+			fmt.Printf("❌ %s: seed 1 played %s, then %s\n", name, first, again)
+			continue
+		}
+		fmt.Printf("✓ %s: seed 1 plays %s, seed 2 plays %s\n", name, first, other)
+	}
+}
+
 func main() {
+	// go run ./Test bench
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		for _, ordering := range Solver.Orderings {
+			result := BenchmarkSearch(ordering)
+			fmt.Printf("BenchmarkSearch/%s\t%s\t%s\n", ordering.Name, result.String(), result.MemString())
+		}
+		return
+	}
+
+	// go run ./Test engine <command> [args] checks an external engine
+	if len(os.Args) > 2 && os.Args[1] == "engine" {
+		CheckEngine(os.Args[2], os.Args[3:])
+		return
+	}
+
+	// go run ./Test seed checks that seeded engines repeat their games
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		CheckSeeds()
+		return
+	}
+
+	// go run ./Test pns checks the proof-number backend instead
+	backend := Solver.AlphaBeta
+	if len(os.Args) > 1 && os.Args[1] == "pns" {
+		backend = Solver.ProofNumber
+	}
+
 	// Run tests
 	fmt.Println("Running mini tests...")
-	TestSolver("Test/mini_test.txt")
+	TestSolver("Test/mini_test.txt", backend)
 	
 	fmt.Println("\nRunning hard tests...")
-	TestSolver("Test/hard_test.txt")
+	TestSolver("Test/hard_test.txt", backend)
 }
\ No newline at end of file
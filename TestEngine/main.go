@@ -0,0 +1,128 @@
+// TestEngine is a small engine that speaks the protocol in package Protocol
+// without using any of the server's packages, the way an outside bot would.
+// It wins when it can, blocks when it must and otherwise plays the most
+// central column.
+//
+//	go build -o testengine ./TestEngine
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	width  = 7
+	height = 6
+)
+
+// board holds 0 for empty cells and 1 or 2 for each player's stones
+type board struct {
+	cells   [width][height]int
+	heights [width]int
+	moves   int
+}
+
+func (b *board) play(col int) {
+	b.cells[col][b.heights[col]] = b.moves%2 + 1
+	b.heights[col]++
+	b.moves++
+}
+
+func (b *board) undo(col int) {
+	b.heights[col]--
+	b.cells[col][b.heights[col]] = 0
+	b.moves--
+}
+
+// wins reports whether the stone at the top of col is part of a four
+func (b *board) wins(col int) bool {
+	row := b.heights[col] - 1
+	stone := b.cells[col][row]
+	for _, d := range [][2]int{{1, 0}, {0, 1}, {1, 1}, {1, -1}} {
+		count := 1
+		for _, sign := range []int{1, -1} {
+			c, r := col+sign*d[0], row+sign*d[1]
+			for c >= 0 && c < width && r >= 0 && r < height && b.cells[c][r] == stone {
+				count++
+				c, r = c+sign*d[0], r+sign*d[1]
+			}
+		}
+		if count >= 4 {
+			return true
+		}
+	}
+	return false
+}
+
+// winningColumn returns a column that completes a four for the player to
+// move, or for their opponent when opponent is set, -1 if there is none
+func (b *board) winningColumn(opponent bool) int {
+	if opponent {
+		b.moves++
+		defer func() { b.moves-- }()
+	}
+	for col := 0; col < width; col++ {
+		if b.heights[col] == height {
+			continue
+		}
+		b.play(col)
+		won := b.wins(col)
+		b.undo(col)
+		if won {
+			return col
+		}
+	}
+	return -1
+}
+
+func (b *board) bestMove() int {
+	if col := b.winningColumn(false); col != -1 {
+		return col
+	}
+	if col := b.winningColumn(true); col != -1 {
+		return col
+	}
+	for _, col := range []int{3, 2, 4, 1, 5, 0, 6} {
+		if b.heights[col] < height {
+			return col
+		}
+	}
+	return -1
+}
+
+func main() {
+	var b board
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "uci":
+			fmt.Println("id name testengine")
+			fmt.Println("uciok")
+		case "isready":
+			fmt.Println("readyok")
+		case "position":
+			b = board{}
+			if len(fields) == 3 && fields[1] == "moves" {
+				for _, ch := range fields[2] {
+					b.play(int(ch - '1'))
+				}
+			}
+		case "go":
+			col := b.bestMove()
+			if col == -1 {
+				fmt.Println("bestmove none")
+			} else {
+				fmt.Printf("bestmove %d\n", col+1)
+			}
+		case "quit":
+			return
+		}
+	}
+}
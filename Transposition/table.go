@@ -0,0 +1,118 @@
+package Transposition
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// Bound says how a stored value relates to the true value of the position
+type Bound uint8
+
+const (
+	Lower Bound = iota + 1 // the value is at least Value
+	Upper                  // the value is at most Value
+	Exact
+)
+
+// Entry is a search result stored in a Table
+type Entry struct {
+	Value int
+	Col   int // best or refuting column, -1 if none
+	Depth int // remaining search depth the value was computed with
+	Bound Bound
+}
+
+// slotBytes is the memory used by one slot
+const slotBytes = 16
+
+// Table is a fixed-size transposition table that is safe to share between
+// concurrent searches without locks. Each slot holds one entry; a new entry
+// replaces whatever hashed to the same slot. The key is stored XORed with
+// the packed entry, so a slot torn by concurrent writers reads as a miss.
+type Table struct {
+	slots []slot
+	shift uint // 64 - log2(len(slots))
+	used  atomic.Int64
+}
+
+type slot struct {
+	check atomic.Uint64 // key ^ data
+	data  atomic.Uint64 // packed Entry, 0 when empty
+}
+
+// NewTable creates a table using at most the given number of bytes. The
+// number of slots is rounded down to a power of two.
+func NewTable(bytes int) *Table {
+	n := bytes / slotBytes
+	if n < 2 {
+		n = 2
+	}
+	size := bits.Len(uint(n)) - 1
+	return &Table{
+		slots: make([]slot, 1<<size),
+		shift: uint(64 - size),
+	}
+}
+
+// Get returns the entry stored for key, if any
+func (t *Table) Get(key uint64) (Entry, bool) {
+	s := t.slot(key)
+	data := s.data.Load()
+	if data == 0 || s.check.Load()^data != key {
+		return Entry{}, false
+	}
+	return unpack(data), true
+}
+
+// Put stores e for key, replacing the slot's previous entry
+func (t *Table) Put(key uint64, e Entry) {
+	s := t.slot(key)
+	data := pack(e)
+	if s.data.Swap(data) == 0 {
+		t.used.Add(1)
+	}
+	s.check.Store(key ^ data)
+}
+
+// Clear empties the table. Searches running at the same time may still add entries.
+func (t *Table) Clear() {
+	for i := range t.slots {
+		t.slots[i].data.Store(0)
+		t.slots[i].check.Store(0)
+	}
+	t.used.Store(0)
+}
+
+// slot returns the slot for key. Keys are mixed first because their low bits
+// only describe the leftmost columns.
+func (t *Table) slot(key uint64) *slot {
+	return &t.slots[(key*0x9e3779b97f4a7c15)>>t.shift]
+}
+
+// Len returns the number of occupied slots
+func (t *Table) Len() int {
+	return int(t.used.Load())
+}
+
+// Cap returns the number of slots
+func (t *Table) Cap() int {
+	return len(t.slots)
+}
+
+// Entries are packed as 16 bits of value (offset by 1<<15), 4 bits of
+// column (offset by 1), 6 bits of depth and 2 bits of bound
+func pack(e Entry) uint64 {
+	return uint64(e.Value+1<<15) |
+		uint64(e.Col+1)<<16 |
+		uint64(e.Depth)<<20 |
+		uint64(e.Bound)<<26
+}
+
+func unpack(data uint64) Entry {
+	return Entry{
+		Value: int(data&0xffff) - 1<<15,
+		Col:   int(data>>16&0xf) - 1,
+		Depth: int(data >> 20 & 0x3f),
+		Bound: Bound(data >> 26 & 0x3),
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"connect4/Engine"
+	"connect4/Metrics"
+	"connect4/Protocol"
+	"connect4/Solver"
+	"connect4/SolverPool"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// solverPool runs every search so concurrent games cannot oversubscribe the CPU
+	solverPool *SolverPool.Pool
+
+	// solveWait is how long a request waits for its search before it is
+	// answered with 202 Accepted and a job ID to poll
+	solveWait = 5 * time.Second
+
+	// externalEngines are the engines loaded from EXTERNAL_ENGINES
+	externalEngines []*Protocol.External
+
+	solvesRejected = Metrics.NewCounter("connect4_solver_jobs_rejected_total",
+		"Searches rejected because the solver queue was full.")
+	_ = Metrics.NewGaugeFunc("connect4_solver_jobs_running",
+		"Solver jobs being worked on.",
+		func() float64 {
+			if solverPool == nil {
+				return 0
+			}
+			return float64(solverPool.Running())
+		})
+	_ = Metrics.NewGaugeFunc("connect4_solver_jobs_queued",
+		"Solver jobs waiting for a worker.",
+		func() float64 {
+			if solverPool == nil {
+				return 0
+			}
+			return float64(solverPool.Queued())
+		})
+)
+
+// loadSolverPool starts the solver pool with SOLVE_CONCURRENCY workers and
+// room for SOLVE_QUEUE_SIZE waiting jobs, and splits TT_MEMORY_MB between the
+// shared transposition table and the private tables of seeded games. The
+// proof-number table, only allocated for proof-number searches, gets as much.
+func loadSolverPool() error {
+	workers := runtime.NumCPU()
+	if value := os.Getenv("SOLVE_CONCURRENCY"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid SOLVE_CONCURRENCY: %s", value)
+		}
+		workers = n
+	}
+
+	queueSize := 256
+	if value := os.Getenv("SOLVE_QUEUE_SIZE"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid SOLVE_QUEUE_SIZE: %s", value)
+		}
+		queueSize = n
+	}
+
+	if value := os.Getenv("SOLVE_WAIT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("invalid SOLVE_WAIT: %s", value)
+		}
+		solveWait = timeout
+	}
+
+	tableBytes := Solver.DefaultTableBytes
+	if value := os.Getenv("TT_MEMORY_MB"); value != "" {
+		mb, err := strconv.Atoi(value)
+		if err != nil || mb < 1 {
+			return fmt.Errorf("invalid TT_MEMORY_MB: %s", value)
+		}
+		tableBytes = mb << 20
+	}
+	seededBytes := tableBytes / 16
+	Engine.SetSeededTableSize(seededBytes)
+	Solver.SetTableSize(tableBytes - Engine.SeededTables*seededBytes)
+	Solver.SetProofTableSize(tableBytes)
+
+	solverPool = SolverPool.New(workers, queueSize)
+	return nil
+}
+
+// loadExternalEngines registers the engines in EXTERNAL_ENGINES, a list of
+// name=command entries separated by semicolons. Each command is split on
+// spaces and run as a separate process speaking the engine protocol.
+func loadExternalEngines() error {
+	value := os.Getenv("EXTERNAL_ENGINES")
+	if value == "" {
+		return nil
+	}
+	for _, entry := range strings.Split(value, ";") {
+		name, command, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		args := strings.Fields(command)
+		if !ok || name == "" || len(args) == 0 {
+			return fmt.Errorf("invalid EXTERNAL_ENGINES entry: %s", entry)
+		}
+		if _, taken := Engine.Get(name); taken {
+			return fmt.Errorf("engine name already in use: %s", name)
+		}
+
+		engine := Protocol.NewExternal(name, args[0], args[1:]...)
+		engine.OnError = func(err error) {
+			slog.Warn("external engine failed", "engine", name, "error", err)
+		}
+		Engine.Register(engine)
+		externalEngines = append(externalEngines, engine)
+	}
+	return nil
+}
+
+// closeExternalEngines stops the processes of the external engines
+func closeExternalEngines() {
+	for _, engine := range externalEngines {
+		engine.Close()
+	}
+}
+
+// submit queues job on the solver pool, counting rejections
+func submit(job SolverPool.Job) (*SolverPool.Future, error) {
+	future, err := solverPool.Submit(job)
+	if errors.Is(err, SolverPool.ErrQueueFull) {
+		solvesRejected.Inc()
+	}
+	return future, err
+}
+
+// submitSolve queues job on the solver pool, answering the request itself
+// when the job cannot be queued
+func submitSolve(c *gin.Context, job SolverPool.Job) (*SolverPool.Future, bool) {
+	future, err := submit(job)
+	if err != nil {
+		solverBusy(c)
+		return nil, false
+	}
+	return future, true
+}
+
+// solverBusy answers a request whose search could not be queued
+func solverBusy(c *gin.Context) {
+	c.Header("Retry-After", "1")
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"success": false,
+		"message": "Server is busy, try again shortly",
+	})
+}
+
+// acceptedJob answers a request whose search is still running
+func acceptedJob(c *gin.Context, future *SolverPool.Future, message string) {
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": message,
+		"jobId":   future.ID,
+	})
+}
+
+func jobHandler(c *gin.Context) {
+	future, status, ok := solverPool.Lookup(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Job not found",
+		})
+		return
+	}
+
+	response := gin.H{
+		"success": true,
+		"jobId":   future.ID,
+		"status":  status,
+	}
+	if status == SolverPool.StatusDone {
+		value, err := future.Result()
+		if err != nil {
+			response["success"] = false
+			response["message"] = err.Error()
+		} else {
+			response["result"] = value
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
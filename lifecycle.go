@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"connect4/Clock"
+	"connect4/History"
+	"connect4/Position"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Server timeouts. Writes must outlast a lobby long poll and a bot search.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 15 * time.Second
+	writeTimeout      = 60 * time.Second
+	idleTimeout       = 120 * time.Second
+)
+
+// ready is false until the server is listening and again once it starts draining
+var ready atomic.Bool
+
+func healthHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func readyHandler(c *gin.Context) {
+	if !ready.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
+
+// serve runs the HTTP server until SIGINT or SIGTERM. In-flight requests get
+// SHUTDOWN_TIMEOUT (default 10s) to finish; after that their contexts are
+// cancelled and the solver pool and external engines are stopped. Unfinished
+// games are then written to liveGamesFile when it is set.
+func serve(handler http.Handler, addr string, liveGamesFile string) error {
+	shutdownTimeout := 10 * time.Second
+	if timeoutEnv := os.Getenv("SHUTDOWN_TIMEOUT"); timeoutEnv != "" {
+		timeout, err := time.ParseDuration(timeoutEnv)
+		if err != nil || timeout <= 0 {
+			return errors.New("invalid SHUTDOWN_TIMEOUT: " + timeoutEnv)
+		}
+		shutdownTimeout = timeout
+	}
+
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return requestCtx
+		},
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(listener)
+	}()
+	ready.Store(true)
+	slog.Info("server starting", "addr", addr)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case sig := <-signals:
+		slog.Info("shutting down", "signal", sig.String())
+	}
+
+	ready.Store(false)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("requests still running at shutdown deadline, cancelling", "error", err)
+		cancelRequests()
+		srv.Close()
+	}
+	solverPool.Stop()
+	closeExternalEngines()
+
+	if err := saveLiveGames(liveGamesFile); err != nil {
+		return err
+	}
+	slog.Info("server stopped")
+	return nil
+}
+
+// liveGame is the saved form of an unfinished game
+type liveGame struct {
+	ID             string         `json:"id"`
+	SpectatorToken string         `json:"spectatorToken"`
+	Moves          []History.Move `json:"moves"`
+	Started        time.Time      `json:"started"`
+	LastActivity   time.Time      `json:"lastActivity"`
+	DrawOffer      int            `json:"drawOffer"`
+	Clock          *Clock.Clock   `json:"clock,omitempty"`
+	PlayerIDs      [2]string      `json:"playerIds"`
+	BotSetting     string         `json:"botSetting"`
+	Seed           int64          `json:"seed,omitempty"`
+	TwoPlayer      bool           `json:"twoPlayer"`
+	AutoBot        bool           `json:"autoBot"`
+	SeatTokens     [2]string      `json:"seatTokens"`
+	SavedAt        time.Time      `json:"savedAt"`
+}
+
+// saveLiveGames writes every unfinished game to path
+func saveLiveGames(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	gamesMutex.Lock()
+	snapshot := make([]*Game, 0, len(games))
+	for _, game := range games {
+		snapshot = append(snapshot, game)
+	}
+	gamesMutex.Unlock()
+
+	now := time.Now()
+	var saved []liveGame
+	for _, game := range snapshot {
+		game.mu.Lock()
+		if !game.getGameState().GameOver {
+			saved = append(saved, liveGame{
+				ID:             game.ID,
+				SpectatorToken: game.SpectatorToken,
+				Moves:          game.Moves,
+				Started:        game.Started,
+				LastActivity:   game.LastActivity,
+				DrawOffer:      game.DrawOffer,
+				Clock:          game.Clock,
+				PlayerIDs:      game.PlayerIDs,
+				BotSetting:     game.BotSetting,
+				Seed:           game.Seed,
+				TwoPlayer:      game.TwoPlayer,
+				AutoBot:        game.AutoBot,
+				SeatTokens:     game.SeatTokens,
+				SavedAt:        now,
+			})
+		}
+		game.mu.Unlock()
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+	slog.Info("saved live games", "count", len(saved), "path", path)
+	return nil
+}
+
+// loadLiveGames restores games saved by saveLiveGames. Time spent while the
+// server was down is not charged to the clocks.
+func loadLiveGames(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var saved []liveGame
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, s := range saved {
+		downtime := now.Sub(s.SavedAt)
+		game := &Game{
+			ID:             s.ID,
+			SpectatorToken: s.SpectatorToken,
+			Position:       Position.NewPosition(),
+			Moves:          s.Moves,
+			Started:        s.Started,
+			LastActivity:   s.LastActivity.Add(downtime),
+			DrawOffer:      s.DrawOffer,
+			Clock:          s.Clock,
+			PlayerIDs:      s.PlayerIDs,
+			BotSetting:     s.BotSetting,
+			Seed:           s.Seed,
+			TwoPlayer:      s.TwoPlayer,
+			AutoBot:        s.AutoBot || s.Clock != nil,
+			SeatTokens:     s.SeatTokens,
+		}
+		for _, move := range s.Moves {
+			game.Position.Play(move.Column)
+		}
+		if game.Clock != nil {
+			game.Clock.TurnStart = game.Clock.TurnStart.Add(downtime)
+		}
+		registerGame(game)
+		gameRestored()
+
+		// Searches do not survive a restart; queue the bot's reply again
+		if game.AutoBot && !game.TwoPlayer && game.Position.GetCurrentPlayer() == 1 {
+			game.mu.Lock()
+			if !game.getGameState().GameOver {
+				if _, err := game.startBotMove(slog.Default()); err != nil {
+					game.botErr = "Bot move could not be queued, call /api/bot"
+				}
+			}
+			game.mu.Unlock()
+		}
+	}
+
+	slog.Info("restored live games", "count", len(saved), "path", path)
+	return nil
+}
@@ -1,39 +1,112 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"connect4/Clock"
+	"connect4/History"
+	"connect4/Lobby"
+	"connect4/Engine"
+	"connect4/Metrics"
+	"connect4/Players"
+	"connect4/Protocol"
 	"connect4/Position"
-	"connect4/Solver"
+	"connect4/Puzzles"
+	"connect4/Review"
+	"connect4/SolverPool"
 
 	"sync"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type Game struct {
+	ID       string
 	Position *Position.Position
+	Moves    []History.Move // moves played, in order
+	Started  time.Time
+	SpectatorToken string // read-only access for viewers
+	Outcome  *Outcome // set when the game ends without a four in a row or full board
+	DrawOffer int // player with a pending draw offer, -1 if none
+	LastActivity time.Time
+	Clock    *Clock.Clock // nil for untimed games
+	PlayerIDs [2]string // registered players per seat, empty for anonymous players and the bot
+	BotSetting string
+	Seed     int64 // seeds the bot's choices between equally good moves, 0 to vary them
+	TwoPlayer bool // both seats are human; there is no bot
+	SeatTokens [2]string // identify the seats of two-player games
+	Finished bool // set once the result has been recorded
+	botJob   *SolverPool.Future // latest bot search, nil before the first
+	botApplied chan struct{} // closed once botJob's result has been handled
+	botErr   string // why the latest bot search produced no move
+	AutoBot  bool // the server plays the bot's reply after every human move
 	mu   sync.Mutex
 }
 
+// Outcome records how a game ended off the board
+type Outcome struct {
+	Winner    int
+	EndReason string
+}
+
+// End reasons reported in GameState
+const (
+	EndFourInARow  = "fourInARow"
+	EndBoardFull   = "boardFull"
+	EndResignation = "resignation"
+	EndDrawAgreed  = "drawAgreed"
+	EndAbandoned   = "abandoned"
+	EndTimeout     = "timeout"
+)
+
+// drawProofMaxEmpty bounds the empty cells for which the bot runs a full
+// solve to decide on a draw offer
+const drawProofMaxEmpty = 24
 
 type GameState struct {
 	Board      [][]int `json:"board"`
-	Winner     int     `json:"winner"`     // -1: no winner, 0: player, 1: bot, 2: tie
+	Winner     int     `json:"winner"`     // -1: no winner, 0: player, 1: bot (or second player), 2: tie
 	GameOver   bool    `json:"gameOver"`
+	EndReason  string  `json:"endReason,omitempty"`
 	LastMove   int     `json:"lastMove"`
 	NumMoves   int     `json:"numMoves"`
-	CurrentPlayer int  `json:"currentPlayer"` // 0: player, 1: bot
+	CurrentPlayer int  `json:"currentPlayer"` // 0: player, 1: bot (or second player)
+	DrawOffer  int     `json:"drawOffer"` // -1: none, otherwise the offering player
+	Clocks     []int64 `json:"clocks,omitempty"` // remaining milliseconds per player
+	BotThinking bool   `json:"botThinking,omitempty"` // a bot search is queued or running
+	BotError   string  `json:"botError,omitempty"` // why the last bot search made no move
+}
+
+// NewGameRequest optionally sets a time control. Leave every field at zero
+// for an untimed game. AutoBot has the server reply for the bot without a
+// call to /api/bot; timed games always do, or the bot's clock would run until
+// the client asked for its move. Bot names the engine the bot plays with, "default" when empty.
+// A non-zero Seed makes the bot repeat its moves; without one they vary. Rated
+// games cannot have one, or a winning line could be learned and replayed.
+type NewGameRequest struct {
+	InitialMs   int64  `json:"initialMs"`
+	IncrementMs int64  `json:"incrementMs"`
+	MoveTimeMs  int64  `json:"moveTimeMs"`
+	AutoBot     bool   `json:"autoBot"`
+	Bot         string `json:"bot"`
+	Seed        int64  `json:"seed"`
 }
 
 type MoveRequest struct {
 	GameID string `json:"gameId"`
 	Column int `json:"column"`
+	SeatToken string `json:"seatToken,omitempty"` // two-player games only
 }
 
 type MoveResponse struct {
@@ -41,29 +114,49 @@ type MoveResponse struct {
 	Message   string    `json:"message"`
 	GameState GameState `json:"gameState"`
 	BotMove   int       `json:"botMove,omitempty"`
+	BotJobID  string    `json:"botJobId,omitempty"`
 }
 
 //var gamePosition *Position.Position
 
 var games = make(map[string]*Game)
+var spectators = make(map[string]*Game) // spectator token -> game
 var gamesMutex sync.Mutex
 
-func (g *Game) getGameState() GameState {
-	board := g.Position.BoardState()
-	
-	// Flip board vertically for display (top row first)
+// errSpectator is returned when a spectator token is used to act on a game
+var errSpectator = errors.New("spectator token cannot act on a game")
+
+// spectatorEvalDepth is the search depth of the optional spectator evaluation
+const spectatorEvalDepth = 10
+
+var puzzleStore *Puzzles.Store
+var playerRegistry *Players.Registry
+var gameArchive *History.Archive
+var gameLobby = Lobby.New(pairLobbyPlayers, 200, time.Minute)
+
+// displayBoard flips the board vertically for display (top row first)
+func displayBoard(position *Position.Position) [][]int {
+	board := position.BoardState()
 	flippedBoard := make([][]int, len(board))
 	for i := range board {
 		flippedBoard[len(board)-1-i] = board[i]
 	}
+	return flippedBoard
+}
+
+func (g *Game) getGameState() GameState {
+	flippedBoard := displayBoard(g.Position)
+	now := time.Now()
 	
 	winner := -1
 	gameOver := false
+	endReason := ""
 	
 	// Check for tie
 	if g.Position.NumMoves == g.Position.BoardHeight*g.Position.BoardWidth {
 		winner = 2
 		gameOver = true
+		endReason = EndBoardFull
 	}
 	
 	// Check for win
@@ -72,29 +165,280 @@ func (g *Game) getGameState() GameState {
 		lastPlayer := 1 - g.Position.GetCurrentPlayer()
 		winner = lastPlayer
 		gameOver = true
+		endReason = EndFourInARow
+	}
+
+	// Flag-fall loses for the player to move
+	if !gameOver && g.Outcome == nil && g.Clock != nil && g.Clock.Flagged(g.Position.GetCurrentPlayer(), now) {
+		g.Outcome = &Outcome{Winner: 1 - g.Position.GetCurrentPlayer(), EndReason: EndTimeout}
+	}
+
+	// Resignations, agreed draws, abandoned games and timeouts
+	if !gameOver && g.Outcome != nil {
+		winner = g.Outcome.Winner
+		gameOver = true
+		endReason = g.Outcome.EndReason
+	}
+
+	if gameOver && !g.Finished {
+		g.Finished = true
+		g.recordResult(winner, endReason)
+	}
+
+	var clocks []int64
+	if g.Clock != nil {
+		for player := 0; player < 2; player++ {
+			left := g.Clock.Left(player, g.Position.GetCurrentPlayer(), now)
+			if gameOver {
+				left = g.Clock.Remaining[player]
+				if endReason == EndTimeout && player == g.Position.GetCurrentPlayer() {
+					left = 0
+				}
+			}
+			clocks = append(clocks, left.Milliseconds())
+		}
 	}
 	
 	return GameState{
 		Board:         flippedBoard,
 		Winner:        winner,
 		GameOver:      gameOver,
+		EndReason:     endReason,
 		LastMove:      g.Position.LastMove,
 		NumMoves:      g.Position.NumMoves,
 		CurrentPlayer: g.Position.GetCurrentPlayer(),
+		DrawOffer:     g.DrawOffer,
+		Clocks:        clocks,
+		BotThinking:   g.botThinking(),
+		BotError:      g.botErr,
 	}
 }
 
-func newGame(c *gin.Context) {
-	gameId := uuid.New().String()
+// botThinking reports whether a bot search has been queued and not yet handled
+func (g *Game) botThinking() bool {
+	if g.botJob == nil {
+		return false
+	}
+	select {
+	case <-g.botApplied:
+		return false
+	default:
+		return true
+	}
+}
+
+// recordResult archives the finished game and updates the human player's rating
+func (g *Game) recordResult(winner int, endReason string) {
+	record := History.Record{
+		ID:        g.ID,
+		PlayerIDs: g.PlayerIDs,
+		Winner:    winner,
+		EndReason: endReason,
+		Started:   g.Started,
+		Ended:     time.Now(),
+		Moves:     append([]History.Move(nil), g.Moves...),
+	}
+	slog.Info("game finished",
+		"game_id", g.ID,
+		"winner", winner,
+		"end_reason", endReason,
+		"plies", len(g.Moves),
+		"two_player", g.TwoPlayer,
+	)
+	gameEnded(g, winner, endReason)
+
+	if err := gameArchive.Add(record); err != nil {
+		slog.Error("archive game", "game_id", g.ID, "error", err)
+	}
 
-	game := &Game{
+	score := 0.0
+	switch winner {
+	case 0:
+		score = 1
+	case 2:
+		score = 0.5
+	}
+
+	if g.TwoPlayer {
+		if g.PlayerIDs[0] == "" || g.PlayerIDs[1] == "" {
+			return
+		}
+		if err := playerRegistry.RecordGame(g.PlayerIDs[0], g.PlayerIDs[1], score); err != nil {
+			slog.Error("record rating", "game_id", g.ID, "error", err)
+		}
+		return
+	}
+
+	if g.PlayerIDs[0] == "" {
+		return
+	}
+	if err := playerRegistry.RecordBotGame(g.PlayerIDs[0], g.BotSetting, score); err != nil {
+		slog.Error("record rating", "game_id", g.ID, "error", err)
+	}
+}
+
+// columns returns the columns played so far
+func (g *Game) columns() []int {
+	cols := make([]int, len(g.Moves))
+	for i, move := range g.Moves {
+		cols[i] = move.Column
+	}
+	return cols
+}
+
+// authorizedPlayer returns the player identified by the request's bearer token
+func authorizedPlayer(c *gin.Context) (Players.Player, bool) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return Players.Player{}, false
+	}
+	return playerRegistry.Authenticate(token)
+}
+
+// seatFor returns the seat the request acts for. Bot games have a single
+// human seat, open to whoever holds the game ID unless a registered player
+// owns it. Two-player games identify the seat by seat token or bearer token.
+func (g *Game) seatFor(c *gin.Context, seatToken string) (int, bool) {
+	if !g.TwoPlayer {
+		if g.PlayerIDs[0] == "" {
+			return 0, true
+		}
+		player, ok := authorizedPlayer(c)
+		return 0, ok && player.ID == g.PlayerIDs[0]
+	}
+
+	for seat, token := range g.SeatTokens {
+		if seatToken != "" && seatToken == token {
+			return seat, true
+		}
+	}
+	if player, ok := authorizedPlayer(c); ok {
+		for seat, id := range g.PlayerIDs {
+			if id != "" && id == player.ID {
+				return seat, true
+			}
+		}
+	}
+	return -1, false
+}
+
+// timeControl converts the request into a time control. timed is false when
+// every field is zero.
+func (r NewGameRequest) timeControl() (Clock.TimeControl, bool, error) {
+	timeControl := Clock.TimeControl{
+		Initial:   time.Duration(r.InitialMs) * time.Millisecond,
+		Increment: time.Duration(r.IncrementMs) * time.Millisecond,
+		PerMove:   time.Duration(r.MoveTimeMs) * time.Millisecond,
+	}
+	if timeControl == (Clock.TimeControl{}) {
+		return timeControl, false, nil
+	}
+	return timeControl, true, timeControl.Validate()
+}
+
+// createGame returns a new bot game with fresh IDs
+func createGame() *Game {
+	now := time.Now()
+	return &Game{
+		ID:       uuid.New().String(),
+		SpectatorToken: uuid.New().String(),
 		Position: Position.NewPosition(),
-		
+		Started:  now,
+		DrawOffer: -1,
+		LastActivity: now,
+		BotSetting: Engine.Default,
 	}
+}
 
+// addGame makes a new game reachable by its ID and spectator token
+func addGame(game *Game) {
+	registerGame(game)
+	gameStarted(game)
+}
+
+// registerGame makes a game reachable by its ID and spectator token without
+// counting it as started
+func registerGame(game *Game) {
 	gamesMutex.Lock()
-	games[gameId] = game
+	games[game.ID] = game
+	spectators[game.SpectatorToken] = game
 	gamesMutex.Unlock()
+}
+
+func newGame(c *gin.Context) {
+	var newReq NewGameRequest
+	if err := c.ShouldBindJSON(&newReq); err != nil && !errors.Is(err, io.EOF) {
+		requestLogger(c).Warn("invalid request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request format",
+		})
+		return
+	}
+
+	timeControl, timed, err := newReq.timeControl()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if _, ok := Engine.Get(newReq.Bot); newReq.Bot != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Unknown bot",
+		})
+		return
+	}
+
+	game := createGame()
+	gameId := game.ID
+	if newReq.Bot != "" {
+		game.BotSetting = newReq.Bot
+	}
+	game.Seed = newReq.Seed
+
+	if c.GetHeader("Authorization") != "" {
+		player, ok := authorizedPlayer(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "Invalid token",
+			})
+			return
+		}
+		if !Players.IsRatedBot(game.BotSetting) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Games against this bot cannot be rated",
+			})
+			return
+		}
+		if newReq.Seed != 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Rated games cannot be seeded",
+			})
+			return
+		}
+		game.PlayerIDs[0] = player.ID
+	}
+
+	if timed {
+		game.Clock = Clock.NewClock(timeControl, game.LastActivity)
+	}
+	game.AutoBot = newReq.AutoBot || timed
+
+	addGame(game)
+	requestLogger(c).Info("game created",
+		"game_id", game.ID,
+		"player_id", game.PlayerIDs[0],
+		"timed", timed,
+		"auto_bot", game.AutoBot,
+		"bot", game.BotSetting,
+	)
 
 	gameState := game.getGameState()
 	
@@ -103,13 +447,14 @@ func newGame(c *gin.Context) {
 		"message":   "New game started",
 		"gameState": gameState,
 		"gameId": gameId,
+		"spectatorToken": game.SpectatorToken,
 
 
 	})
 }
 
 // makePlayerMove handles the player's move and validation
-func (g *Game) makeMove(c *gin.Context, moveReq MoveRequest) {
+func (g *Game) makeMove(c *gin.Context, moveReq MoveRequest, seat int) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
@@ -141,8 +486,8 @@ func (g *Game) makeMove(c *gin.Context, moveReq MoveRequest) {
 		return
 	}
 	
-	// Check if it's player's turn (player is 0)
-	if g.Position.GetCurrentPlayer() != 0 {
+	// Check if it's this seat's turn (the player is 0 in bot games)
+	if g.Position.GetCurrentPlayer() != seat {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Not player's turn",
@@ -151,63 +496,371 @@ func (g *Game) makeMove(c *gin.Context, moveReq MoveRequest) {
 	}
 	
 	// Make player move
+	g.LastActivity = time.Now()
 	g.Position.Play(moveReq.Column)
+	g.Moves = append(g.Moves, History.Move{Column: moveReq.Column, Player: seat, Time: g.LastActivity})
+	g.DrawOffer = -1
+	if g.Clock != nil {
+		g.Clock.Switch(seat, g.LastActivity)
+	}
+	requestLogger(c).Info("move played",
+		"game_id", g.ID,
+		"seat", seat,
+		"column", moveReq.Column,
+		"ply", len(g.Moves),
+	)
 	
+	// Queue the bot's reply; the client picks it up from /api/status
+	response := MoveResponse{
+		Success: true,
+		Message: "Player move made successfully",
+	}
+	if g.AutoBot && !g.TwoPlayer && !g.getGameState().GameOver {
+		if future, err := g.startBotMove(requestLogger(c)); err != nil {
+			requestLogger(c).Warn("bot move not queued", "game_id", g.ID, "error", err)
+			g.botErr = "Bot move could not be queued, call /api/bot"
+		} else {
+			response.BotJobID = future.ID
+		}
+	}
+
 	// Return current game state after player move
-	gameState := g.getGameState()
-	c.JSON(http.StatusOK, MoveResponse{
-		Success:   true,
-		Message:   "Player move made successfully",
-		GameState: gameState,
-	})
+	response.GameState = g.getGameState()
+	c.JSON(http.StatusOK, response)
 }
 
-// getBotMove handles the bot's move logic
+// makeBotMove queues the bot's search and waits up to solveWait for the move.
+// A slower search is answered with 202 Accepted and a job ID to poll.
 func (g *Game) makeBotMove(c *gin.Context) {
-	// Check if game is over
 	g.mu.Lock()
-	defer g.mu.Unlock()
-	currentState := g.getGameState()
-	if currentState.GameOver {
+	if g.TwoPlayer {
+		g.mu.Unlock()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "No bot in this game",
+		})
+		return
+	}
+	if g.getGameState().GameOver {
+		g.mu.Unlock()
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Game is already over",
 		})
 		return
 	}
-	
+
 	// Check if it's bot's turn (bot is 1)
 	if g.Position.GetCurrentPlayer() != 1 {
+		g.mu.Unlock()
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Not bot's turn",
 		})
 		return
 	}
-	
-	// Make bot move
-	botMove := Solver.MakeBestMove(g.Position)
-	if botMove == -1 || !g.Position.CanPlay(botMove) {
-		c.JSON(http.StatusInternalServerError, gin.H{
+
+	ply := g.Position.NumMoves
+	future, err := g.startBotMove(requestLogger(c))
+	applied := g.botApplied
+	g.mu.Unlock()
+	if err != nil {
+		solverBusy(c)
+		return
+	}
+
+	timer := time.NewTimer(solveWait)
+	defer timer.Stop()
+	select {
+	case <-applied:
+	case <-timer.C:
+		acceptedJob(c, future, "Bot is thinking")
+		return
+	case <-c.Request.Context().Done():
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.Moves) > ply {
+		c.JSON(http.StatusOK, MoveResponse{
+			Success:   true,
+			Message:   "Bot move made successfully",
+			GameState: g.getGameState(),
+			BotMove:   g.Moves[ply].Column,
+		})
+		return
+	}
+	if g.botErr != "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"success": false,
-			"message": "Bot could not make a valid move",
+			"message": g.botErr,
 		})
 		return
 	}
-	
-	g.Position.Play(botMove)
-	
-	// Get final game state after bot move
-	finalGameState := g.getGameState()
-	
+
+	// The game ended while the bot was searching
+	message := "Game ended before the bot moved"
+	if g.getGameState().EndReason == EndTimeout {
+		message = "Bot ran out of time"
+	}
+	c.JSON(http.StatusOK, MoveResponse{
+		Success:   false,
+		Message:   message,
+		GameState: g.getGameState(),
+	})
+}
+
+// startBotMove queues a search for the bot's move unless one is already
+// pending, and applies the result when it arrives. The caller holds g.mu.
+func (g *Game) startBotMove(logger *slog.Logger) (*SolverPool.Future, error) {
+	if g.botThinking() {
+		return g.botJob, nil
+	}
+
+	future, err := submit(g.botSearch())
+	if err != nil {
+		return nil, err
+	}
+	g.botJob = future
+	g.botApplied = make(chan struct{})
+	g.botErr = ""
+	go g.applyBotMove(future, g.Position.NumMoves, g.botApplied, logger)
+	return future, nil
+}
+
+// botSearch makes the job that asks the game's engine for the bot's move.
+// Games restored with an engine that is no longer registered use the
+// default one. The caller holds g.mu.
+func (g *Game) botSearch() SolverPool.Job {
+	engine, ok := Engine.Get(g.BotSetting)
+	if !ok {
+		engine, _ = Engine.Get(Engine.Default)
+	}
+	// Each move of a seeded game gets its own seed, never 0, so the bot does
+	// not break every tie alike
+	limits := Engine.Limits{MoveTime: g.botMoveTime()}
+	if g.Seed != 0 {
+		cells := g.Position.BoardWidth * g.Position.BoardHeight
+		limits.Seed = g.Seed*int64(cells+1) + int64(g.Position.NumMoves)
+	}
+	return SolverPool.EngineMove(engine, g.Position, limits, SolverPool.PriorityLive)
+}
+
+// botMoveTime is how long the bot may search in a timed game: a share of its
+// remaining time, or half of a per-move budget. Untimed games return 0, which
+// leaves the search unlimited. The caller holds g.mu.
+func (g *Game) botMoveTime() time.Duration {
+	if g.Clock == nil {
+		return 0
+	}
+	left := g.Clock.Left(1, g.Position.GetCurrentPlayer(), time.Now())
+	budget := left / 2
+	if g.Clock.Control.PerMove == 0 {
+		budget = min(left/20+g.Clock.Control.Increment/2, budget)
+	}
+	return max(budget, time.Millisecond)
+}
+
+// applyBotMove plays the bot's move once its search finishes, provided the
+// game is still where it was when the search started
+func (g *Game) applyBotMove(future *SolverPool.Future, ply int, applied chan struct{}, logger *slog.Logger) {
+	<-future.Done()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	defer close(applied)
+
+	value, err := future.Result()
+	if err != nil {
+		logger.Warn("bot search failed", "game_id", g.ID, "job_id", future.ID, "error", err)
+		g.botErr = "Bot search was cancelled"
+		return
+	}
+	if g.Position.NumMoves != ply || g.getGameState().GameOver {
+		return
+	}
+
+	result := value.(SolverPool.MoveResult)
+	botSearched(result.Duration, result.Info)
+	logger.Info("bot search",
+		"game_id", g.ID,
+		"job_id", future.ID,
+		"engine", result.Engine,
+		"duration_ms", result.Duration.Milliseconds(),
+		"score", result.Info.Score,
+		"column", result.Col,
+		"depth", result.Info.Depth,
+		"nodes", result.Info.Nodes,
+	)
+	if result.Col == -1 || !g.Position.CanPlay(result.Col) {
+		logger.Error("bot could not make a valid move", "game_id", g.ID, "column", result.Col)
+		g.botErr = "Bot could not make a valid move"
+		return
+	}
+
+	g.LastActivity = time.Now()
+	g.Position.Play(result.Col)
+	g.Moves = append(g.Moves, History.Move{Column: result.Col, Player: 1, Time: g.LastActivity})
+	g.DrawOffer = -1
+	if g.Clock != nil {
+		g.Clock.Switch(1, g.LastActivity)
+	}
+}
+
+
+// resign ends the game in the opponent's favour
+func (g *Game) resign(c *gin.Context, seat int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.getGameState().GameOver {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Game is already over",
+		})
+		return
+	}
+
+	g.Outcome = &Outcome{Winner: 1 - seat, EndReason: EndResignation}
+	g.LastActivity = time.Now()
+
 	c.JSON(http.StatusOK, MoveResponse{
 		Success:   true,
-		Message:   "Bot move made successfully",
-		GameState: finalGameState,
-		BotMove:   botMove,
+		Message:   "Player resigned",
+		GameState: g.getGameState(),
 	})
 }
 
+// offerDraw records the player's draw offer. The bot accepts only when a full
+// solve proves the position is a draw; a human opponent answers with acceptDraw.
+// The game is unlocked while the bot waits for the proof.
+func (g *Game) offerDraw(c *gin.Context, seat int) {
+	g.mu.Lock()
+	if g.getGameState().GameOver {
+		g.mu.Unlock()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Game is already over",
+		})
+		return
+	}
+
+	g.DrawOffer = seat
+	g.LastActivity = time.Now()
+
+	if g.TwoPlayer {
+		defer g.mu.Unlock()
+		c.JSON(http.StatusOK, MoveResponse{
+			Success:   true,
+			Message:   "Draw offered",
+			GameState: g.getGameState(),
+		})
+		return
+	}
+
+	ply := g.Position.NumMoves
+	position := g.Position.Copy()
+	g.mu.Unlock()
+
+	accepts := botAcceptsDraw(c.Request.Context(), position)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// A move or another ending while the bot was thinking voids the offer
+	message := "Bot declined the draw"
+	if accepts && g.Position.NumMoves == ply && g.DrawOffer == seat && !g.getGameState().GameOver {
+		g.Outcome = &Outcome{Winner: 2, EndReason: EndDrawAgreed}
+		message = "Bot accepted the draw"
+	}
+	g.DrawOffer = -1
+
+	c.JSON(http.StatusOK, MoveResponse{
+		Success:   true,
+		Message:   message,
+		GameState: g.getGameState(),
+	})
+}
+
+// acceptDraw accepts the opponent's pending draw offer
+func (g *Game) acceptDraw(c *gin.Context, seat int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.getGameState().GameOver {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Game is already over",
+		})
+		return
+	}
+
+	if g.DrawOffer != 1-seat {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "No draw offer to accept",
+		})
+		return
+	}
+
+	g.Outcome = &Outcome{Winner: 2, EndReason: EndDrawAgreed}
+	g.DrawOffer = -1
+	g.LastActivity = time.Now()
+
+	c.JSON(http.StatusOK, MoveResponse{
+		Success:   true,
+		Message:   "Draw accepted",
+		GameState: g.getGameState(),
+	})
+}
+
+// botAcceptsDraw solves the position to the end of the game and reports
+// whether it is a proven draw. A search that fails or outlasts solveWait declines.
+func botAcceptsDraw(ctx context.Context, position *Position.Position) bool {
+	empty := position.BoardWidth*position.BoardHeight - position.NumMoves
+	if empty > drawProofMaxEmpty {
+		return false
+	}
+
+	future, err := submit(SolverPool.Solve(position, true, 0, empty, SolverPool.PriorityLive))
+	if err != nil || !future.Wait(ctx, solveWait) {
+		return false
+	}
+	value, err := future.Result()
+	return err == nil && value.(SolverPool.SolveResult).Score == 0
+}
+
+// abandonStaleGames periodically ends games with no moves for longer than
+// timeout. The player to move forfeits; the human is the only side that can
+// abandon a bot game, so there the bot is always awarded the win.
+func abandonStaleGames(timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		gamesMutex.Lock()
+		snapshot := make([]*Game, 0, len(games))
+		for _, game := range games {
+			snapshot = append(snapshot, game)
+		}
+		gamesMutex.Unlock()
+
+		for _, game := range snapshot {
+			game.mu.Lock()
+			if !game.getGameState().GameOver && time.Since(game.LastActivity) > timeout {
+				winner := 1
+				if game.TwoPlayer {
+					winner = 1 - game.Position.GetCurrentPlayer()
+				}
+				game.Outcome = &Outcome{Winner: winner, EndReason: EndAbandoned}
+				game.DrawOffer = -1
+			}
+			game.mu.Unlock()
+		}
+	}
+}
 
 func (g *Game) getStatus(c *gin.Context) {
 	g.mu.Lock()
@@ -223,8 +876,12 @@ func getGameByID(req MoveRequest) (*Game, error) {
 	
 	gamesMutex.Lock()
 	game, ok := games[req.GameID]
+	_, spectating := spectators[req.GameID]
 	gamesMutex.Unlock()
 
+	if spectating {
+		return nil, errSpectator
+	}
 	if !ok {
 		
 		return nil, errors.New("error reading the game from games slice")
@@ -237,7 +894,7 @@ func moveHandler(c *gin.Context) {
 
 	var moveReq MoveRequest
 	if err := c.ShouldBindJSON(&moveReq); err != nil {
-		fmt.Println(err)
+		requestLogger(c).Warn("invalid request", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Invalid request format",
@@ -245,6 +902,13 @@ func moveHandler(c *gin.Context) {
 		return
 	}
 	game, err := getGameByID(moveReq)
+	if errors.Is(err, errSpectator) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Spectators cannot act on the game",
+		})
+		return
+	}
 	if  err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -252,13 +916,21 @@ func moveHandler(c *gin.Context) {
 		})
 		return
 	}
-	game.makeMove(c, moveReq)
+	seat, ok := game.seatFor(c, moveReq.SeatToken)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Not your game",
+		})
+		return
+	}
+	game.makeMove(c, moveReq, seat)
 }
 
 func botmoveHandler(c *gin.Context) {
 	var moveReq MoveRequest
 	if err := c.ShouldBindJSON(&moveReq); err != nil {
-		fmt.Println(err)
+		requestLogger(c).Warn("invalid request", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Invalid request format",
@@ -266,6 +938,13 @@ func botmoveHandler(c *gin.Context) {
 		return
 	}
 	game, err := getGameByID(moveReq)
+	if errors.Is(err, errSpectator) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Spectators cannot act on the game",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
@@ -276,6 +955,45 @@ func botmoveHandler(c *gin.Context) {
 	game.makeBotMove(c)
 }
 
+// gameActionHandler binds a game ID from the body and runs action on the game
+func gameActionHandler(action func(*Game, *gin.Context, int)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var moveReq MoveRequest
+		if err := c.ShouldBindJSON(&moveReq); err != nil {
+			requestLogger(c).Warn("invalid request", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request format",
+			})
+			return
+		}
+		game, err := getGameByID(moveReq)
+		if errors.Is(err, errSpectator) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "Spectators cannot act on the game",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Could not retrieve Game",
+			})
+			return
+		}
+		seat, ok := game.seatFor(c, moveReq.SeatToken)
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "Not your game",
+			})
+			return
+		}
+		action(game, c, seat)
+	}
+}
+
 func statusHandler(c *gin.Context) {
 	gameID := c.Query("gameId")
 	if gameID == "" {
@@ -301,31 +1019,653 @@ func statusHandler(c *gin.Context) {
 	})
 }
 
+// Evaluation is the engine's view of a position for spectators
+type Evaluation struct {
+	Score      int `json:"score"` // from the point of view of the player to move
+	BestColumn int `json:"bestColumn"`
+	Depth      int `json:"depth"`
+}
+
+// spectateHandler serves the read-only view of a game. It never exposes the
+// game ID, so spectators cannot use the player endpoints.
+func spectateHandler(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false})
+		return
+	}
+
+	gamesMutex.Lock()
+	game, ok := spectators[token]
+	gamesMutex.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false})
+		return
+	}
+
+	game.mu.Lock()
+	gameState := game.getGameState()
+	moves := append([]History.Move(nil), game.Moves...)
+	position := game.Position.Copy()
+	game.mu.Unlock()
+
+	response := gin.H{
+		"success":   true,
+		"gameState": gameState,
+		"moves":     moves,
+	}
+
+	// Evaluate on a copy so the search does not hold up the players. A busy
+	// solver leaves out the evaluation but not the view.
+	if c.Query("eval") == "true" && !gameState.GameOver {
+		job := SolverPool.Solve(position, false, 0, spectatorEvalDepth, SolverPool.PriorityAnalysis)
+		future, err := submit(job)
+		if err != nil {
+			requestLogger(c).Warn("spectator evaluation not queued", "error", err)
+		} else if !future.Wait(c.Request.Context(), solveWait) {
+			response["evaluationJobId"] = future.ID
+		} else if value, err := future.Result(); err == nil {
+			result := value.(SolverPool.SolveResult)
+			response["evaluation"] = Evaluation{
+				Score:      result.Score,
+				BestColumn: result.Col,
+				Depth:      spectatorEvalDepth,
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func reviewHandler(c *gin.Context) {
+	game, err := getGameByID(MoveRequest{GameID: c.Query("gameId")})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "Could not retrieve Game",
+		})
+		return
+	}
+
+	game.mu.Lock()
+	gameOver := game.getGameState().GameOver
+	moves := game.columns()
+	game.mu.Unlock()
+
+	if !gameOver {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Game is not over yet",
+		})
+		return
+	}
+
+	future, ok := submitSolve(c, SolverPool.Job{
+		Key:      "review:" + game.ID,
+		Priority: SolverPool.PriorityAnalysis,
+		Task: func(ctx context.Context) (interface{}, error) {
+			return Review.Annotate(ctx, moves, Review.DefaultDepth)
+		},
+	})
+	if !ok {
+		return
+	}
+	if !future.Wait(c.Request.Context(), solveWait) {
+		acceptedJob(c, future, "Review is being prepared")
+		return
+	}
+
+	annotations, err := future.Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	response := gin.H{
+		"success": true,
+		"moves":   annotations,
+	}
+	for _, annotation := range annotations.([]Review.Annotation) {
+		if annotation.Classification == Review.Undecided {
+			response["note"] = "Moves are only classified once their results are proven, which openings rarely are"
+			break
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func gamesHandler(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid page"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid pageSize"})
+		return
+	}
+
+	filter := History.Filter{
+		PlayerID: c.Query("player"),
+		Result:   c.Query("result"),
+	}
+	switch filter.Result {
+	case "", History.ResultWin, History.ResultLoss, History.ResultDraw:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid result"})
+		return
+	}
+
+	// from and to are inclusive calendar days in UTC
+	if from := c.Query("from"); from != "" {
+		day, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid from date"})
+			return
+		}
+		filter.From = day
+	}
+	if to := c.Query("to"); to != "" {
+		day, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid to date"})
+			return
+		}
+		filter.To = day.AddDate(0, 0, 1)
+	}
+
+	records, total, err := gameArchive.List(filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"games":    records,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// ReplayPly is the board after one move of a replayed game
+type ReplayPly struct {
+	Ply    int       `json:"ply"`
+	Column int       `json:"column"`
+	Player int       `json:"player"`
+	Time   time.Time `json:"time"`
+	Board  [][]int   `json:"board"`
+}
+
+func replayHandler(c *gin.Context) {
+	record, ok := gameArchive.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Game not found"})
+		return
+	}
+
+	position := Position.NewPosition()
+	plies := make([]ReplayPly, 0, len(record.Moves))
+	for i, move := range record.Moves {
+		position.Play(move.Column)
+		plies = append(plies, ReplayPly{
+			Ply:    i,
+			Column: move.Column,
+			Player: move.Player,
+			Time:   move.Time,
+			Board:  displayBoard(position),
+		})
+	}
+
+	record.Moves = nil
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"game":    record,
+		"plies":   plies,
+	})
+}
+
+// LobbyJoinRequest joins the queue, or keeps waiting on an existing ticket
+// when TicketID is set
+type LobbyJoinRequest struct {
+	NewGameRequest
+	TicketID   string `json:"ticketId"`
+	RatingBand bool   `json:"ratingBand"`
+}
+
+type LobbyLeaveRequest struct {
+	TicketID string `json:"ticketId"`
+}
+
+// lobbyWait is how long a join request is held open waiting for an opponent
+const lobbyWait = 25 * time.Second
+
+// pairLobbyPlayers creates the two-seat game for a matched pair, choosing
+// at random who moves first
+func pairLobbyPlayers(a, b Lobby.Ticket) ([2]Lobby.Match, error) {
+	game := createGame()
+	game.TwoPlayer = true
+	game.BotSetting = ""
+
+	seats := [2]int{0, 1}
+	if rand.Intn(2) == 1 {
+		seats = [2]int{1, 0}
+	}
+
+	var matches [2]Lobby.Match
+	for i, ticket := range [2]Lobby.Ticket{a, b} {
+		seat := seats[i]
+		game.PlayerIDs[seat] = ticket.PlayerID
+		game.SeatTokens[seat] = uuid.New().String()
+		matches[i] = Lobby.Match{
+			GameID:    game.ID,
+			Seat:      seat,
+			SeatToken: game.SeatTokens[seat],
+		}
+	}
+
+	if a.TimeControl != (Clock.TimeControl{}) {
+		game.Clock = Clock.NewClock(a.TimeControl, game.LastActivity)
+	}
 
+	addGame(game)
+	slog.Info("game created",
+		"game_id", game.ID,
+		"two_player", true,
+		"timed", game.Clock != nil,
+	)
+	return matches, nil
+}
 
+func lobbyJoinHandler(c *gin.Context) {
+	var joinReq LobbyJoinRequest
+	if err := c.ShouldBindJSON(&joinReq); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request format",
+		})
+		return
+	}
+
+	ticketID := joinReq.TicketID
+	if ticketID == "" {
+		timeControl, _, err := joinReq.timeControl()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+
+		ticket := Lobby.Ticket{
+			Rating:      Players.InitialRating,
+			TimeControl: timeControl,
+			RatingBand:  joinReq.RatingBand,
+		}
+		if c.GetHeader("Authorization") != "" {
+			player, ok := authorizedPlayer(c)
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "Invalid token"})
+				return
+			}
+			ticket.PlayerID = player.ID
+			ticket.Rating = player.Rating
+		}
+
+		ticketID, err = gameLobby.Join(ticket)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not join lobby"})
+			return
+		}
+	}
+
+	match, matched, err := gameLobby.Wait(c.Request.Context(), ticketID, lobbyWait)
+	if errors.Is(err, Lobby.ErrUnknownTicket) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Ticket not found"})
+		return
+	}
+
+	response := gin.H{
+		"success":  true,
+		"matched":  matched,
+		"ticketId": ticketID,
+	}
+	if matched {
+		response["match"] = match
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func lobbyLeaveHandler(c *gin.Context) {
+	var leaveReq LobbyLeaveRequest
+	if err := c.ShouldBindJSON(&leaveReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request format",
+		})
+		return
+	}
+
+	if !gameLobby.Leave(leaveReq.TicketID) {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Ticket not waiting"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+type RegisterRequest struct {
+	Name string `json:"name"`
+}
+
+func registerHandler(c *gin.Context) {
+	var registerReq RegisterRequest
+	if err := c.ShouldBindJSON(&registerReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request format",
+		})
+		return
+	}
+
+	player, token, err := playerRegistry.Register(registerReq.Name)
+	if errors.Is(err, Players.ErrNameTaken) {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"player":  player.Public(),
+		"token":   token,
+	})
+}
+
+func leaderboardHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "Invalid limit"})
+		return
+	}
+
+	board := playerRegistry.Leaderboard(limit)
+	for i := range board {
+		board[i] = board[i].Public()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"leaderboard": board,
+	})
+}
+
+// enginesHandler lists the engines a game can be started with
+func enginesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"engines": Engine.Names(),
+		"default": Engine.Default,
+	})
+}
+
+// runEngine serves the named engine, or the default one, over the engine
+// protocol on standard input and output, and returns the exit status
+func runEngine(args []string) int {
+	name := Engine.Default
+	if len(args) > 0 {
+		name = args[0]
+	}
+	engine, ok := Engine.Get(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown engine %q, choose one of %s\n", name, strings.Join(Engine.Names(), ", "))
+		return 2
+	}
+	if err := Protocol.Serve(os.Stdin, os.Stdout, engine); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+type PuzzleAnswerRequest struct {
+	PuzzleID string `json:"puzzleId"`
+	Moves    []int  `json:"moves"`
+}
+
+func puzzleHandler(c *gin.Context) {
+	var puzzle Puzzles.Puzzle
+	if id := c.Query("id"); id != "" {
+		p, ok := findPuzzle(c, id)
+		if !ok {
+			return
+		}
+		puzzle = p
+	} else {
+		p, ok := dailyPuzzle(c, time.Now())
+		if !ok {
+			return
+		}
+		puzzle = p
+	}
+
+	position := puzzle.Position()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"puzzle": gin.H{
+			"id":            puzzle.ID,
+			"date":          puzzle.Date,
+			"moves":         puzzle.Moves,
+			"movesToWin":    puzzle.MovesToWin,
+			"rating":        puzzle.Rating,
+			"difficulty":    puzzle.Difficulty,
+			"board":         displayBoard(position),
+			"currentPlayer": position.GetCurrentPlayer(),
+		},
+	})
+}
+
+// findPuzzle returns the puzzle with the given ID. Daily puzzles are found on
+// any server, generated again if need be. It answers the request itself when
+// there is no puzzle.
+func findPuzzle(c *gin.Context, id string) (Puzzles.Puzzle, bool) {
+	if p, ok := puzzleStore.Get(id); ok {
+		return p, true
+	}
+	if day, ok := Puzzles.DailyDay(id); ok && !day.After(time.Now()) {
+		return dailyPuzzle(c, day)
+	}
+	c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "Puzzle not found"})
+	return Puzzles.Puzzle{}, false
+}
+
+// dailyPuzzle returns the puzzle of day, generating it on the solver pool
+// when needed. It answers the request itself when there is no puzzle yet.
+func dailyPuzzle(c *gin.Context, day time.Time) (Puzzles.Puzzle, bool) {
+	if p, ok := puzzleStore.Cached(day); ok {
+		return p, true
+	}
+
+	future, queued := submitSolve(c, SolverPool.Job{
+		Key:      "puzzle:" + day.UTC().Format("2006-01-02"),
+		Priority: SolverPool.PriorityPuzzle,
+		Task: func(ctx context.Context) (interface{}, error) {
+			return puzzleStore.Daily(ctx, day)
+		},
+	})
+	if !queued {
+		return Puzzles.Puzzle{}, false
+	}
+	if !future.Wait(c.Request.Context(), solveWait) {
+		acceptedJob(c, future, "Puzzle is being generated")
+		return Puzzles.Puzzle{}, false
+	}
+	value, err := future.Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not generate puzzle"})
+		return Puzzles.Puzzle{}, false
+	}
+	return value.(Puzzles.Puzzle), true
+}
+
+func puzzleAnswerHandler(c *gin.Context) {
+	var answerReq PuzzleAnswerRequest
+	if err := c.ShouldBindJSON(&answerReq); err != nil || len(answerReq.Moves) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request format",
+		})
+		return
+	}
+
+	puzzle, ok := findPuzzle(c, answerReq.PuzzleID)
+	if !ok {
+		return
+	}
+
+	moves := answerReq.Moves
+	future, ok := submitSolve(c, SolverPool.Job{
+		Key:      fmt.Sprintf("puzzle-answer:%s:%v", puzzle.ID, moves),
+		Priority: SolverPool.PriorityAnalysis,
+		Task: func(ctx context.Context) (interface{}, error) {
+			return puzzle.Check(ctx, moves)
+		},
+	})
+	if !ok {
+		return
+	}
+	if !future.Wait(c.Request.Context(), solveWait) {
+		acceptedJob(c, future, "Answer is being checked")
+		return
+	}
+
+	verdict, err := future.Result()
+	if errors.Is(err, Puzzles.ErrIllegalMove) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "Could not check answer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"verdict": verdict,
+	})
+}
 
 func main() {
+	// "connect4 engine [name]" plays as an engine over standard input and output
+	if len(os.Args) > 1 && os.Args[1] == "engine" {
+		os.Exit(runEngine(os.Args[2:]))
+	}
+
+	slog.SetDefault(newLogger())
+
+	store, err := Puzzles.NewStore(os.Getenv("PUZZLES_FILE"))
+	if err != nil {
+		slog.Error("load puzzles", "error", err)
+		os.Exit(1)
+	}
+	puzzleStore = store
+
+	registry, err := Players.NewRegistry(os.Getenv("PLAYERS_FILE"))
+	if err != nil {
+		slog.Error("load players", "error", err)
+		os.Exit(1)
+	}
+	playerRegistry = registry
+
+	archive, err := History.NewArchive(os.Getenv("GAMES_FILE"))
+	if err != nil {
+		slog.Error("load game archive", "error", err)
+		os.Exit(1)
+	}
+	gameArchive = archive
+
+	abandonTimeout := 30 * time.Minute
+	if timeoutEnv := os.Getenv("ABANDON_TIMEOUT"); timeoutEnv != "" {
+		timeout, err := time.ParseDuration(timeoutEnv)
+		if err != nil || timeout <= 0 {
+			slog.Error("invalid ABANDON_TIMEOUT", "value", timeoutEnv)
+			os.Exit(1)
+		}
+		abandonTimeout = timeout
+	}
+	go abandonStaleGames(abandonTimeout)
+
+	if err := loadLimits(); err != nil {
+		slog.Error("configure limits", "error", err)
+		os.Exit(1)
+	}
+	if err := loadExternalEngines(); err != nil {
+		slog.Error("load external engines", "error", err)
+		os.Exit(1)
+	}
+	if err := loadSolverPool(); err != nil {
+		slog.Error("start solver pool", "error", err)
+		os.Exit(1)
+	}
+
+	liveGamesFile := os.Getenv("LIVE_GAMES_FILE")
+	if err := loadLiveGames(liveGamesFile); err != nil {
+		slog.Error("restore live games", "error", err)
+		os.Exit(1)
+	}
 	
 	
 	// Create Gin router
-	r := gin.Default()
+	r := gin.New()
+	if err := trustProxies(r); err != nil {
+		slog.Error("configure proxies", "error", err)
+		os.Exit(1)
+	}
+	r.Use(gin.Recovery(), requestLogging(), requestMetrics())
 	
 	// Configure CORS
-	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
-	r.Use(cors.New(config))
+	corsHandler, err := corsMiddleware()
+	if err != nil {
+		slog.Error("configure CORS", "error", err)
+		os.Exit(1)
+	}
+	if corsHandler != nil {
+		r.Use(corsHandler)
+	}
 	
 	// API routes
 	api := r.Group("/api")
 	{
-		api.POST("/new", newGame)
+		api.POST("/new", rateLimit(createLimits), newGame)
 		api.POST("/move", moveHandler)
-		api.POST("/bot", botmoveHandler)
+		api.POST("/bot", rateLimit(botLimits), botmoveHandler)
 		api.GET("/status", statusHandler)
+		api.GET("/spectate", spectateHandler)
+		api.POST("/resign", gameActionHandler((*Game).resign))
+		api.POST("/draw/offer", gameActionHandler((*Game).offerDraw))
+		api.POST("/draw/accept", gameActionHandler((*Game).acceptDraw))
+		api.POST("/review", rateLimit(analysisLimits), reviewHandler)
+		api.GET("/jobs/:id", jobHandler)
+		api.GET("/engines", enginesHandler)
+		api.GET("/games", gamesHandler)
+		api.GET("/games/:id/replay", replayHandler)
+		api.POST("/lobby/join", rateLimit(createLimits), lobbyJoinHandler)
+		api.POST("/lobby/leave", lobbyLeaveHandler)
+		api.POST("/players", rateLimit(registerLimits), registerHandler)
+		api.GET("/leaderboard", leaderboardHandler)
+		api.GET("/puzzle", puzzleHandler)
+		api.POST("/puzzle/answer", rateLimit(analysisLimits), puzzleAnswerHandler)
 	}
 	
+	r.GET("/metrics", gin.WrapH(Metrics.Handler()))
+	r.GET("/healthz", healthHandler)
+	r.GET("/readyz", readyHandler)
+
 	// Serve static files
 	r.Static("/static", "./static")
 	r.LoadHTMLGlob("templates/*")
@@ -342,5 +1682,8 @@ func main() {
 		port = portEnv
 	}
 	
-	r.Run(":" + port)
+	if err := serve(r, ":"+port, liveGamesFile); err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"time"
+
+	"connect4/Engine"
+	"connect4/Metrics"
+	"connect4/Solver"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	activeGames = Metrics.NewGauge("connect4_active_games",
+		"Games that have started and not finished.")
+	gamesStarted = Metrics.NewCounter("connect4_games_started_total",
+		"Games started, by mode (bot or two_player).", "mode")
+	gamesFinished = Metrics.NewCounter("connect4_games_finished_total",
+		"Games finished, by mode, result for the first seat (win, loss or draw) and end reason.",
+		"mode", "result", "end_reason")
+	requestDuration = Metrics.NewHistogram("connect4_request_duration_seconds",
+		"API request latency by endpoint.",
+		Metrics.ExponentialBuckets(0.001, 2, 14), "endpoint")
+	botSearchDuration = Metrics.NewHistogram("connect4_bot_search_duration_seconds",
+		"Time spent searching for a bot move.",
+		Metrics.ExponentialBuckets(0.001, 2, 14))
+	botSearchNodes = Metrics.NewHistogram("connect4_bot_search_nodes",
+		"Positions visited per bot search.",
+		Metrics.ExponentialBuckets(100, 4, 10))
+	_ = Metrics.NewGaugeFunc("connect4_transposition_table_entries",
+		"Occupied slots in the shared transposition table.",
+		func() float64 {
+			return float64(Solver.Table().Len())
+		})
+	ttLookups = Metrics.NewCounter("connect4_transposition_table_lookups_total",
+		"Transposition table lookups during bot searches, by result (hit or miss).", "result")
+	_ = Metrics.NewGaugeFunc("connect4_games_in_memory",
+		"Games held in the server's games map, finished or not.",
+		func() float64 {
+			gamesMutex.Lock()
+			defer gamesMutex.Unlock()
+			return float64(len(games))
+		})
+)
+
+// gameMode labels a game for metrics
+func gameMode(g *Game) string {
+	if g.TwoPlayer {
+		return "two_player"
+	}
+	return "bot"
+}
+
+// gameStarted counts a new game
+func gameStarted(g *Game) {
+	gamesStarted.Inc(gameMode(g))
+	activeGames.Add(1)
+}
+
+// gameRestored counts a game saved at shutdown as active again. It was
+// counted as started before the restart.
+func gameRestored() {
+	activeGames.Add(1)
+}
+
+// gameEnded counts a finished game. Results are from the first seat's side.
+func gameEnded(g *Game, winner int, endReason string) {
+	result := "draw"
+	switch winner {
+	case 0:
+		result = "win"
+	case 1:
+		result = "loss"
+	}
+	gamesFinished.Inc(gameMode(g), result, endReason)
+	activeGames.Add(-1)
+}
+
+// botSearched records the cost of one bot search
+func botSearched(duration time.Duration, info Engine.Info) {
+	botSearchDuration.Observe(duration.Seconds())
+	botSearchNodes.Observe(float64(info.Nodes))
+	ttLookups.Add(float64(info.TTHits), "hit")
+	ttLookups.Add(float64(info.TTMisses), "miss")
+}
+
+// requestMetrics times API requests by route
+func requestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		endpoint := c.FullPath()
+		if endpoint == "" {
+			endpoint = "unmatched"
+		}
+		requestDuration.Observe(time.Since(start).Seconds(), endpoint)
+	}
+}
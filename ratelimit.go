@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"connect4/Metrics"
+	"connect4/RateLimit"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// budget is a token bucket setting: requests per minute and burst size
+type budget struct {
+	perMinute float64
+	burst     int
+}
+
+// endpointLimits limits an endpoint by player for authenticated requests and
+// by client IP otherwise, so players sharing an address are not throttled
+// together. Endpoints without a token limit count every request by IP.
+type endpointLimits struct {
+	name    string
+	byIP    *RateLimit.Limiter
+	byToken *RateLimit.Limiter
+}
+
+var (
+	createLimits   *endpointLimits
+	botLimits      *endpointLimits
+	registerLimits *endpointLimits
+	analysisLimits *endpointLimits
+
+	rateLimited = Metrics.NewCounter("connect4_rate_limited_total",
+		"Requests rejected by a rate limit, by budget (create, bot, register or analysis).", "budget")
+)
+
+// parseBudget reads a budget written as "perMinute:burst", e.g. "30:10"
+func parseBudget(value string) (budget, error) {
+	rate, burst, ok := strings.Cut(value, ":")
+	if !ok {
+		return budget{}, fmt.Errorf("want perMinute:burst, got %q", value)
+	}
+	perMinute, err := strconv.ParseFloat(rate, 64)
+	if err != nil || perMinute <= 0 {
+		return budget{}, fmt.Errorf("invalid rate %q", rate)
+	}
+	size, err := strconv.Atoi(burst)
+	if err != nil || size < 1 {
+		return budget{}, fmt.Errorf("invalid burst %q", burst)
+	}
+	return budget{perMinute: perMinute, burst: size}, nil
+}
+
+// budgetFromEnv reads the budget in env, falling back to def when unset
+func budgetFromEnv(env string, def budget) (budget, error) {
+	value := os.Getenv(env)
+	if value == "" {
+		return def, nil
+	}
+	b, err := parseBudget(value)
+	if err != nil {
+		return budget{}, fmt.Errorf("invalid %s: %w", env, err)
+	}
+	return b, nil
+}
+
+// newEndpointLimits builds the limits for one budget from its IP and token env vars
+func newEndpointLimits(name, ipEnv, tokenEnv string, ipDefault, tokenDefault budget) (*endpointLimits, error) {
+	ip, err := budgetFromEnv(ipEnv, ipDefault)
+	if err != nil {
+		return nil, err
+	}
+	token, err := budgetFromEnv(tokenEnv, tokenDefault)
+	if err != nil {
+		return nil, err
+	}
+	return &endpointLimits{
+		name:    name,
+		byIP:    RateLimit.NewLimiter(ip.perMinute, ip.burst),
+		byToken: RateLimit.NewLimiter(token.perMinute, token.burst),
+	}, nil
+}
+
+// loadLimits configures the rate limits
+func loadLimits() error {
+	var err error
+	createLimits, err = newEndpointLimits("create", "RATE_NEW_IP", "RATE_NEW_TOKEN",
+		budget{perMinute: 10, burst: 5}, budget{perMinute: 20, burst: 10})
+	if err != nil {
+		return err
+	}
+	botLimits, err = newEndpointLimits("bot", "RATE_BOT_IP", "RATE_BOT_TOKEN",
+		budget{perMinute: 60, burst: 10}, budget{perMinute: 120, burst: 20})
+	if err != nil {
+		return err
+	}
+	analysisLimits, err = newEndpointLimits("analysis", "RATE_ANALYSIS_IP", "RATE_ANALYSIS_TOKEN",
+		budget{perMinute: 20, burst: 5}, budget{perMinute: 40, burst: 10})
+	if err != nil {
+		return err
+	}
+
+	// Every registration hands out a token with a fresh budget, so it is
+	// limited by IP alone
+	register, err := budgetFromEnv("RATE_REGISTER_IP", budget{perMinute: 2, burst: 5})
+	if err != nil {
+		return err
+	}
+	registerLimits = &endpointLimits{
+		name: "register",
+		byIP: RateLimit.NewLimiter(register.perMinute, register.burst),
+	}
+	return nil
+}
+
+// trustProxies sets the proxies allowed to report the client IP in
+// X-Forwarded-For from TRUSTED_PROXIES, a comma separated list of addresses
+// or CIDR ranges. When it is unset no proxy is trusted and the client IP is
+// the address of the connection.
+func trustProxies(r *gin.Engine) error {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	return nil
+}
+
+// rateLimit rejects requests over the endpoint's budget with 429 Too Many Requests
+func rateLimit(limits *endpointLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter, key := limits.byIP, c.ClientIP()
+		if player, ok := authorizedPlayer(c); ok && limits.byToken != nil {
+			limiter, key = limits.byToken, player.ID
+		}
+
+		if ok, wait := limiter.Allow(key); !ok {
+			rateLimited.Inc(limits.name)
+			requestLogger(c).Warn("rate limited", "budget", limits.name, "key", key)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"success": false,
+				"message": "Too many requests, try again later",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// corsMiddleware allows cross-origin requests from the origins listed in
+// CORS_ORIGINS (comma separated, or * for any). When it is unset only
+// same-origin requests are served, which is all the bundled page needs.
+func corsMiddleware() (gin.HandlerFunc, error) {
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("CORS_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		return nil, nil
+	}
+
+	config := cors.DefaultConfig()
+	if len(origins) == 1 && origins[0] == "*" {
+		config.AllowAllOrigins = true
+	} else {
+		config.AllowOrigins = origins
+	}
+	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", requestIDHeader}
+	config.ExposeHeaders = []string{requestIDHeader, "Retry-After"}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid CORS_ORIGINS: %w", err)
+	}
+	return cors.New(config), nil
+}